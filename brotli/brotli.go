@@ -0,0 +1,51 @@
+// Package brotli provides a logr.Compressor compressing the rotated files with brotli.
+//
+// It is a separate module so that logr doesn't depend on a brotli implementation.
+package brotli
+
+import (
+	"errors"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/vrischmann/logr"
+)
+
+// Extension is the extension of the compressed files.
+const Extension = ".br"
+
+// ErrInvalidQuality is returned by New when the quality is out of range.
+var ErrInvalidQuality = errors.New("logr/brotli: invalid quality")
+
+// New returns a Compressor using brotli with the quality level, between
+// brotli.BestSpeed and brotli.BestCompression, otherwise New returns
+// ErrInvalidQuality.
+//
+// The higher levels give the best ratios for text logs but are much slower, they
+// suit the rotated files which are kept for a long time.
+func New(quality int) (logr.Compressor, error) {
+	if quality < brotli.BestSpeed || quality > brotli.BestCompression {
+		return nil, ErrInvalidQuality
+	}
+
+	return compressor{quality: quality}, nil
+}
+
+type compressor struct {
+	quality int
+}
+
+func (c compressor) Extension() string {
+	return Extension
+}
+
+func (c compressor) Compress(dst io.Writer, src io.Reader) error {
+	bw := brotli.NewWriterLevel(dst, c.quality)
+
+	if _, err := io.Copy(bw, src); err != nil {
+		bw.Close()
+		return err
+	}
+
+	return bw.Close()
+}
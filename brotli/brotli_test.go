@@ -0,0 +1,35 @@
+package brotli_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/require"
+	logrbrotli "github.com/vrischmann/logr/brotli"
+)
+
+func TestCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("foobar\n"), 1000)
+
+	for _, quality := range []int{brotli.BestSpeed, brotli.DefaultCompression, brotli.BestCompression} {
+		c, err := logrbrotli.New(quality)
+		require.Nil(t, err)
+		require.Equal(t, ".br", c.Extension())
+
+		var buf bytes.Buffer
+		require.Nil(t, c.Compress(&buf, bytes.NewReader(data)))
+
+		decompressed, err := ioutil.ReadAll(brotli.NewReader(&buf))
+		require.Nil(t, err)
+		require.Equal(t, data, decompressed)
+	}
+}
+
+func TestInvalidQuality(t *testing.T) {
+	for _, quality := range []int{-1, 12} {
+		_, err := logrbrotli.New(quality)
+		require.Equal(t, logrbrotli.ErrInvalidQuality, err)
+	}
+}
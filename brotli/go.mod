@@ -0,0 +1,13 @@
+module github.com/vrischmann/logr/brotli
+
+go 1.21
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/stretchr/testify v1.12.1
+	github.com/vrischmann/logr v0.0.0-00010101000000-000000000000
+)
+
+require go.yaml.in/yaml/v3 v3.0.5 // indirect
+
+replace github.com/vrischmann/logr => ../
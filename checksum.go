@@ -0,0 +1,86 @@
+package logr
+
+import (
+	"crypto"
+	_ "crypto/md5"    // registers crypto.MD5
+	_ "crypto/sha1"   // registers crypto.SHA1
+	_ "crypto/sha256" // registers crypto.SHA256
+	_ "crypto/sha512" // registers crypto.SHA512
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// checksumExtensions are the extensions of the checksum files for each supported hash.
+var checksumExtensions = map[crypto.Hash]string{
+	crypto.MD5:    ".md5",
+	crypto.SHA1:   ".sha1",
+	crypto.SHA256: ".sha256",
+	crypto.SHA512: ".sha512",
+}
+
+// Checksum tells the writer to write next to each rotated file, once compressed if
+// compression is enabled, a file containing its checksum computed with h.
+//
+// The checksum file is named after the rotated file with the extension of the hash
+// appended, for example app.log.2006-01-02_1504.gz.sha256, and contains the checksum
+// as a lowercase hexadecimal string followed by a newline. It is removed with the
+// rotated file. The supported hashes are crypto.MD5, crypto.SHA1, crypto.SHA256 and
+// crypto.SHA512, Checksum panics for any other one.
+func (w *RotatingWriter) Checksum(h crypto.Hash) *RotatingWriter {
+	if _, ok := checksumExtensions[h]; !ok {
+		panic("logr: unsupported checksum hash")
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.checksum = h
+
+	return w
+}
+
+// checksumPath returns the path of the checksum file of the file at path, or an
+// empty string if no checksum is computed.
+func checksumPath(path string, h crypto.Hash) string {
+	if h == 0 {
+		return ""
+	}
+
+	return path + checksumExtensions[h]
+}
+
+// writeChecksum writes the checksum file of the file at path, if a hash is set.
+func writeChecksum(path string, h crypto.Hash) error {
+	if h == 0 {
+		return nil
+	}
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hash := h.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	out, err := fsys.OpenFile(checksumPath(path, h), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(out, hex.EncodeToString(hash.Sum(nil))+"\n"); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
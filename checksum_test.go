@@ -0,0 +1,76 @@
+package logr_test
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vrischmann/logr"
+)
+
+func TestChecksum(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).Checksum(crypto.SHA256).MaxBackups(1)
+
+	rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour))
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0100.gz", "app.log.2015-01-01_0100.gz.sha256"}, names)
+
+	sum := sha256.Sum256(readFile(t, filepath.Join(dir, "app.log.2015-01-01_0100.gz")))
+	require.Equal(t, hex.EncodeToString(sum[:])+"\n", string(readFile(t, filepath.Join(dir, "app.log.2015-01-01_0100.gz.sha256"))))
+}
+
+func TestChecksumSequentialNaming(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().Checksum(crypto.SHA256)
+
+	for _, s := range []string{"foo", "bar"} {
+		_, err := rw.WriteString(s)
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	for name, s := range map[string]string{"app.log.1": "bar", "app.log.2": "foo"} {
+		sum := sha256.Sum256([]byte(s))
+		require.Equal(t, []byte(s), readFile(t, filepath.Join(dir, name)))
+		require.Equal(t, hex.EncodeToString(sum[:])+"\n", string(readFile(t, filepath.Join(dir, name+".sha256"))))
+	}
+}
+
+func TestChecksumCompressExisting(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	// left uncompressed by a previous run, with its checksum.
+	archive := filepath.Join(dir, "app.log.2015-01-01_0000")
+	require.Nil(t, ioutil.WriteFile(archive, makeBuf(0xFF), 0600))
+	require.Nil(t, ioutil.WriteFile(archive+".sha256", []byte("checksum\n"), 0600))
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Checksum(crypto.SHA256).CompressExisting()
+
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0000.gz", "app.log.2015-01-01_0000.gz.sha256"}, dirNames(t, dir))
+
+	sum := sha256.Sum256(readFile(t, archive+".gz"))
+	require.Equal(t, hex.EncodeToString(sum[:])+"\n", string(readFile(t, archive+".gz.sha256")))
+}
@@ -0,0 +1,200 @@
+package logr
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Compressor compresses the rotated files.
+type Compressor interface {
+	// Extension returns the extension appended to the name of the compressed files,
+	// including the leading dot.
+	Extension() string
+
+	// Compress reads the data from src and writes it compressed to dst.
+	Compress(dst io.Writer, src io.Reader) error
+}
+
+// gzipWriterPools holds a pool of gzip writers for each compression level, from
+// gzip.HuffmanOnly to gzip.BestCompression.
+var gzipWriterPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// gzipCompressor is the default Compressor.
+type gzipCompressor struct {
+	level int
+}
+
+func (c gzipCompressor) Extension() string {
+	return ".gz"
+}
+
+func (c gzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	z, err := c.getWriter(dst)
+	if err != nil {
+		return err
+	}
+	defer c.putWriter(z)
+
+	if _, err := io.Copy(z, src); err != nil {
+		z.Close()
+		return err
+	}
+
+	return z.Close()
+}
+
+// getWriter returns a gzip writer writing to dst, reusing one from the pool if possible.
+func (c gzipCompressor) getWriter(dst io.Writer) (*gzip.Writer, error) {
+	if c.level < gzip.HuffmanOnly || c.level > gzip.BestCompression {
+		// let gzip return the error.
+		return gzip.NewWriterLevel(dst, c.level)
+	}
+
+	if z, ok := gzipWriterPools[c.level-gzip.HuffmanOnly].Get().(*gzip.Writer); ok {
+		z.Reset(dst)
+		return z, nil
+	}
+
+	return gzip.NewWriterLevel(dst, c.level)
+}
+
+// putWriter puts back a closed gzip writer in the pool.
+func (c gzipCompressor) putWriter(z *gzip.Writer) {
+	// don't keep a reference to the destination.
+	z.Reset(nil)
+	gzipWriterPools[c.level-gzip.HuffmanOnly].Put(z)
+}
+
+// bufferedCompressor reads and writes the data of a Compressor through buffers.
+type bufferedCompressor struct {
+	Compressor
+	size int
+}
+
+func (c bufferedCompressor) Compress(dst io.Writer, src io.Reader) error {
+	bw := bufio.NewWriterSize(dst, c.size)
+
+	if err := c.Compressor.Compress(bw, bufio.NewReaderSize(src, c.size)); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// extensionCompressor overrides the extension of a Compressor.
+type extensionCompressor struct {
+	Compressor
+	extension string
+}
+
+func (c extensionCompressor) Extension() string {
+	return c.extension
+}
+
+// ParallelGzipCompressor returns a Compressor using gzip which splits the data in
+// blocks of blockSize bytes, compressed concurrently by up to workers goroutines.
+//
+// Each block is written as a gzip member, the output is a standard multi-member gzip
+// file readable by gunzip and gzip.Reader, slightly bigger than with a single member.
+// At most 2*workers blocks are held in memory.
+//
+// The level must be between gzip.HuffmanOnly and gzip.BestCompression, and blockSize
+// and workers must be positive, otherwise ParallelGzipCompressor panics.
+func ParallelGzipCompressor(level, blockSize, workers int) Compressor {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		panic("logr: invalid compression level")
+	}
+	if blockSize <= 0 || workers <= 0 {
+		panic("logr: invalid block size or number of workers")
+	}
+
+	return parallelGzipCompressor{
+		gzipCompressor: gzipCompressor{level: level},
+		blockSize:      blockSize,
+		workers:        workers,
+	}
+}
+
+type parallelGzipCompressor struct {
+	gzipCompressor
+	blockSize int
+	workers   int
+}
+
+// gzipBlock is a block of data compressed by a parallelGzipCompressor.
+type gzipBlock struct {
+	data []byte
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+func (c parallelGzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	// the blocks are queued in order, while they are compressed concurrently.
+	blocks := make(chan *gzipBlock, c.workers)
+	stop := make(chan struct{})
+	sem := make(chan struct{}, c.workers)
+
+	var readErr error
+	go func() {
+		defer close(blocks)
+
+		for first := true; ; first = false {
+			data := make([]byte, c.blockSize)
+			n, err := io.ReadFull(src, data)
+
+			// empty data still gives a gzip member.
+			if n > 0 || first {
+				b := &gzipBlock{data: data[:n], done: make(chan struct{})}
+
+				sem <- struct{}{}
+				go func() {
+					defer func() {
+						<-sem
+						close(b.done)
+					}()
+					b.err = c.gzipCompressor.Compress(&b.out, bytes.NewReader(b.data))
+				}()
+
+				select {
+				case blocks <- b:
+				case <-stop:
+					return
+				}
+			}
+
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+		}
+	}()
+
+	var err error
+	for b := range blocks {
+		<-b.done
+
+		if err != nil {
+			continue
+		}
+
+		if err = b.err; err == nil {
+			_, err = dst.Write(b.out.Bytes())
+		}
+		if err != nil {
+			close(stop)
+		}
+	}
+
+	if err == nil {
+		err = readErr
+	}
+
+	return err
+}
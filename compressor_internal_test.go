@@ -0,0 +1,94 @@
+package logr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("foobar\n"), 1000)
+
+	for level := gzip.HuffmanOnly; level <= gzip.BestCompression; level++ {
+		c := gzipCompressor{level: level}
+
+		// the second time reuses the writer from the pool.
+		for i := 0; i < 2; i++ {
+			var buf bytes.Buffer
+			require.Nil(t, c.Compress(&buf, bytes.NewReader(data)))
+
+			r, err := gzip.NewReader(&buf)
+			require.Nil(t, err)
+
+			gunzip, err := ioutil.ReadAll(r)
+			require.Nil(t, err)
+			require.Equal(t, data, gunzip)
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NotNil(t, gzipCompressor{level: 42}.Compress(&buf, bytes.NewReader(data)))
+}
+
+func TestParallelGzipCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("foobar\n"), 1000)
+
+	for _, size := range []int{0, 1, 100, len(data)} {
+		for _, workers := range []int{1, 4} {
+			c := ParallelGzipCompressor(gzip.DefaultCompression, 100, workers)
+
+			var buf bytes.Buffer
+			require.Nil(t, c.Compress(&buf, bytes.NewReader(data[:size])))
+
+			r, err := gzip.NewReader(&buf)
+			require.Nil(t, err)
+
+			gunzip, err := ioutil.ReadAll(r)
+			require.Nil(t, err)
+			require.Equal(t, data[:size], gunzip)
+		}
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) { return 0, errors.New("read error") }
+
+func TestParallelGzipCompressorReadError(t *testing.T) {
+	c := ParallelGzipCompressor(gzip.DefaultCompression, 100, 4)
+
+	var buf bytes.Buffer
+	err := c.Compress(&buf, io.MultiReader(bytes.NewReader(make([]byte, 1000)), errReader{}))
+	require.Equal(t, "read error", err.Error())
+}
+
+// countingWriter counts the calls to Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestBufferedCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("foobar\n"), 100000)
+
+	var unbuffered countingWriter
+	require.Nil(t, gzipCompressor{level: gzip.NoCompression}.Compress(&unbuffered, bytes.NewReader(data)))
+
+	var buffered countingWriter
+	c := bufferedCompressor{Compressor: gzipCompressor{level: gzip.NoCompression}, size: 1 << 20}
+	require.Nil(t, c.Compress(&buffered, bytes.NewReader(data)))
+	require.Equal(t, ".gz", c.Extension())
+
+	require.True(t, buffered.writes < unbuffered.writes)
+	require.Equal(t, unbuffered.Bytes(), buffered.Bytes())
+}
@@ -0,0 +1,131 @@
+package logr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidConfig is returned by NewWriterFromConfig when the configuration is invalid.
+var ErrInvalidConfig = errors.New("logr: invalid configuration")
+
+// Config is the configuration of a RotatingWriter, meant to be loaded from a
+// configuration file. The zero value of a field leaves the default behaviour.
+type Config struct {
+	// Filename is the path of the file, it is required.
+	Filename string `json:"filename" yaml:"filename"`
+
+	// MaxSize is the size at which to rotate the file, in bytes, see MaxSize.
+	MaxSize int64 `json:"max_size" yaml:"max_size"`
+
+	// Daily rotates the file each day, see Daily.
+	Daily bool `json:"daily" yaml:"daily"`
+
+	// Compress compresses the rotated files with gzip.
+	Compress bool `json:"compress" yaml:"compress"`
+
+	// TimeFormat is the time format of the names of the rotated files, see TimeFormat.
+	TimeFormat string `json:"time_format" yaml:"time_format"`
+
+	// Prefix puts the time format before the extension, see Prefix.
+	Prefix bool `json:"prefix" yaml:"prefix"`
+
+	// MaxBackups is the maximum number of rotated files to keep, see MaxBackups.
+	MaxBackups int `json:"max_backups" yaml:"max_backups"`
+
+	// MaxAge is the maximum age of the rotated files to keep, see MaxAge.
+	MaxAge Duration `json:"max_age" yaml:"max_age"`
+}
+
+// Duration is a time.Duration written in configuration files as a string parsed by
+// time.ParseDuration, such as "24h" or "90m".
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// NewWriterFromConfig creates a new file like NewWriter and returns a rotating writer
+// configured with c.
+//
+// It returns an error wrapping ErrInvalidConfig if c is invalid, without creating the
+// file, and if the writer configured with c is invalid according to Validate.
+func NewWriterFromConfig(c Config) (*RotatingWriter, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	w, err := NewWriterWithOptions(c.Filename, c.options()...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Validate(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// validate returns an error if the configuration is invalid or has conflicting options.
+func (c Config) validate() error {
+	switch {
+	case c.Filename == "":
+		return fmt.Errorf("%w: no filename", ErrInvalidConfig)
+	case c.MaxSize < 0:
+		return fmt.Errorf("%w: negative max size", ErrInvalidConfig)
+	case c.MaxBackups < 0:
+		return fmt.Errorf("%w: negative max backups", ErrInvalidConfig)
+	case c.MaxAge < 0:
+		return fmt.Errorf("%w: negative max age", ErrInvalidConfig)
+	}
+
+	if c.TimeFormat != "" {
+		return validateTimeFormat(c.TimeFormat)
+	}
+
+	return nil
+}
+
+// options returns the options equivalent to the configuration.
+func (c Config) options() []Option {
+	var opts []Option
+
+	if c.MaxSize > 0 {
+		opts = append(opts, WithMaxSize(c.MaxSize))
+	}
+	if c.Daily {
+		opts = append(opts, WithDaily())
+	}
+	if c.Compress {
+		opts = append(opts, WithCompression())
+	}
+	if c.TimeFormat != "" {
+		opts = append(opts, WithTimeFormat(c.TimeFormat))
+	}
+	if c.Prefix {
+		opts = append(opts, WithPrefix())
+	}
+	if c.MaxBackups > 0 {
+		opts = append(opts, WithMaxBackups(c.MaxBackups))
+	}
+	if c.MaxAge > 0 {
+		opts = append(opts, WithMaxAge(time.Duration(c.MaxAge)))
+	}
+
+	return opts
+}
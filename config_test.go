@@ -0,0 +1,90 @@
+package logr_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vrischmann/logr"
+)
+
+func TestNewWriterFromConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	filename := filepath.Join(dir, "app.log")
+
+	var c logr.Config
+	require.Nil(t, json.Unmarshal([]byte(`{
+		"filename": "`+filename+`",
+		"max_size": 512,
+		"compress": true,
+		"time_format": "2006__01__02",
+		"prefix": true
+	}`), &c))
+
+	rw, err := logr.NewWriterFromConfig(c)
+	require.Nil(t, err)
+
+	now := time.Now()
+	{
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+
+		_, err = rw.Write(makeBuf(0xFE))
+		require.Nil(t, err)
+	}
+	require.Nil(t, rw.Close())
+
+	require.Nil(t, checkEqual(t, readFile(t, filename), 0xFE))
+
+	r, err := gzip.NewReader(bytes.NewReader(readFile(t, filepath.Join(dir, "app."+now.Format("2006__01__02")+".log.gz"))))
+	require.Nil(t, err)
+
+	gunzip, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, checkEqual(t, gunzip, 0xFF))
+}
+
+func TestConfigMaxAge(t *testing.T) {
+	var c logr.Config
+	require.Nil(t, json.Unmarshal([]byte(`{"filename": "app.log", "max_age": "24h"}`), &c))
+	require.Equal(t, logr.Duration(24*time.Hour), c.MaxAge)
+
+	c.MaxAge = logr.Duration(90 * time.Minute)
+	data, err := json.Marshal(c)
+	require.Nil(t, err)
+	require.Contains(t, string(data), `"max_age":"1h30m0s"`)
+
+	require.NotNil(t, json.Unmarshal([]byte(`{"max_age": "1 day"}`), &c))
+}
+
+func TestNewWriterFromInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	filename := filepath.Join(dir, "app.log")
+
+	testCases := []logr.Config{
+		{},
+		{Filename: filename, MaxSize: -1},
+		{Filename: filename, MaxBackups: -1},
+		{Filename: filename, MaxAge: logr.Duration(-time.Hour)},
+		{Filename: filename, MaxAge: logr.Duration(time.Hour), TimeFormat: "backup"},
+		{Filename: filename, TimeFormat: "2006/01/02"},
+	}
+
+	for _, c := range testCases {
+		_, err := logr.NewWriterFromConfig(c)
+		require.True(t, errors.Is(err, logr.ErrInvalidConfig))
+	}
+
+	// the file is not created.
+	_, err := os.Stat(filename)
+	require.True(t, os.IsNotExist(err))
+}
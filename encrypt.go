@@ -0,0 +1,197 @@
+package logr
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// encryptChunkSize is the size of the chunks of data encrypted separately.
+const encryptChunkSize = 64 * 1024
+
+// ErrDecrypt is returned by Decrypt when the data can't be decrypted, because the key
+// is wrong or the data was altered or truncated.
+var ErrDecrypt = errors.New("logr: can't decrypt the data")
+
+// EncryptCompressor returns a Compressor compressing the data with c, or leaving it
+// uncompressed if c is nil, then encrypting it with AES-GCM using key, which must be
+// 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256. The extension is the
+// one of c followed by ".enc".
+//
+// The data is encrypted in chunks of 64 KiB, the last one being possibly shorter or
+// empty. Each chunk is written as a random 12 bytes nonce, the length of the sealed
+// chunk as a 4 bytes big endian integer, then the sealed chunk, which includes the 16
+// bytes tag. The additional data of a chunk is its index, starting at 0, as an 8 bytes
+// big endian integer followed by a byte set to 1 for the last chunk and 0 otherwise,
+// so that reordering or truncating the chunks is detected. Decrypt decrypts this format.
+func EncryptCompressor(c Compressor, key []byte) (Compressor, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptCompressor{c: c, aead: aead}, nil
+}
+
+// Decrypt decrypts the data encrypted by a Compressor returned by EncryptCompressor
+// from src to dst. The data written to dst is still compressed if it was.
+func Decrypt(dst io.Writer, src io.Reader, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, aead.NonceSize()+4)
+	for index := uint64(0); ; index++ {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ErrDecrypt
+			}
+			return err
+		}
+
+		n := binary.BigEndian.Uint32(header[aead.NonceSize():])
+		if n > encryptChunkSize+uint32(aead.Overhead()) {
+			return ErrDecrypt
+		}
+
+		sealed := make([]byte, n)
+		if _, err := io.ReadFull(src, sealed); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ErrDecrypt
+			}
+			return err
+		}
+
+		// try as the last chunk first, it must be followed by nothing.
+		last := true
+		data, err := aead.Open(nil, header[:aead.NonceSize()], sealed, additionalData(index, true))
+		if err != nil {
+			last = false
+			data, err = aead.Open(nil, header[:aead.NonceSize()], sealed, additionalData(index, false))
+		}
+		if err != nil {
+			return ErrDecrypt
+		}
+
+		if _, err := dst.Write(data); err != nil {
+			return err
+		}
+
+		if last {
+			var b [1]byte
+			if n, _ := src.Read(b[:]); n > 0 {
+				return ErrDecrypt
+			}
+			return nil
+		}
+	}
+}
+
+// newAEAD returns an AES-GCM AEAD using key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// additionalData returns the additional data of the chunk at index.
+func additionalData(index uint64, last bool) []byte {
+	var ad [9]byte
+	binary.BigEndian.PutUint64(ad[:8], index)
+	if last {
+		ad[8] = 1
+	}
+
+	return ad[:]
+}
+
+type encryptCompressor struct {
+	c    Compressor
+	aead cipher.AEAD
+}
+
+func (c encryptCompressor) Extension() string {
+	if c.c == nil {
+		return ".enc"
+	}
+
+	return c.c.Extension() + ".enc"
+}
+
+func (c encryptCompressor) Compress(dst io.Writer, src io.Reader) error {
+	ew := &encryptWriter{dst: dst, aead: c.aead, buf: make([]byte, 0, encryptChunkSize)}
+
+	var err error
+	if c.c == nil {
+		_, err = io.Copy(ew, src)
+	} else {
+		err = c.c.Compress(ew, src)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ew.Close()
+}
+
+// encryptWriter encrypts the data written to it in chunks, writing them to dst.
+type encryptWriter struct {
+	dst   io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only written once more data follows, the last one is
+		// written by Close.
+		if len(w.buf) == encryptChunkSize {
+			if err := w.writeChunk(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):encryptChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close writes the last chunk.
+func (w *encryptWriter) Close() error {
+	return w.writeChunk(true)
+}
+
+func (w *encryptWriter) writeChunk(last bool) error {
+	header := make([]byte, w.aead.NonceSize()+4)
+	if _, err := rand.Read(header[:w.aead.NonceSize()]); err != nil {
+		return err
+	}
+
+	sealed := w.aead.Seal(nil, header[:w.aead.NonceSize()], w.buf, additionalData(w.index, last))
+	binary.BigEndian.PutUint32(header[w.aead.NonceSize():], uint32(len(sealed)))
+
+	if _, err := w.dst.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.dst.Write(sealed); err != nil {
+		return err
+	}
+
+	w.buf = w.buf[:0]
+	w.index++
+
+	return nil
+}
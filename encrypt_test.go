@@ -0,0 +1,72 @@
+package logr_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vrischmann/logr"
+)
+
+func TestEncryptCompressor(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+
+	_, err := logr.EncryptCompressor(nil, key[:10])
+	require.NotNil(t, err)
+
+	// empty, shorter than a chunk, exactly one chunk and several chunks.
+	for _, size := range []int{0, 100, 64 * 1024, 200 * 1024} {
+		data := bytes.Repeat([]byte("x"), size)
+
+		c, err := logr.EncryptCompressor(nil, key)
+		require.Nil(t, err)
+		require.Equal(t, ".enc", c.Extension())
+
+		var encrypted bytes.Buffer
+		require.Nil(t, c.Compress(&encrypted, bytes.NewReader(data)))
+
+		var decrypted bytes.Buffer
+		require.Nil(t, logr.Decrypt(&decrypted, bytes.NewReader(encrypted.Bytes()), key))
+		require.True(t, bytes.Equal(data, decrypted.Bytes()))
+
+		// truncated, altered and with another key.
+		b := encrypted.Bytes()
+		require.Equal(t, logr.ErrDecrypt, logr.Decrypt(ioutil.Discard, bytes.NewReader(b[:len(b)-1]), key))
+		b[len(b)-1] ^= 1
+		require.Equal(t, logr.ErrDecrypt, logr.Decrypt(ioutil.Discard, bytes.NewReader(b), key))
+		b[len(b)-1] ^= 1
+		require.Equal(t, logr.ErrDecrypt, logr.Decrypt(ioutil.Discard, bytes.NewReader(b), bytes.Repeat([]byte{0x43}, 32)))
+	}
+}
+
+func TestEncryptRotatedFiles(t *testing.T) {
+	f := tempLogFile(t)
+	key := bytes.Repeat([]byte{0x42}, 16)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+
+	c, err := logr.EncryptCompressor(logr.ParallelGzipCompressor(gzip.DefaultCompression, 1024, 2), key)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).Compressor(c)
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+	require.Nil(t, rw.Rotate())
+
+	var decrypted bytes.Buffer
+	archive := filepath.Join(filepath.Dir(f.Name()), "app.log.2015-01-01_0000.gz.enc")
+	require.Nil(t, logr.Decrypt(&decrypted, bytes.NewReader(readFile(t, archive)), key))
+
+	r, err := gzip.NewReader(&decrypted)
+	require.Nil(t, err)
+
+	data, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, makeBuf(0xFF), data)
+}
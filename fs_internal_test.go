@@ -0,0 +1,211 @@
+package logr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// faultyFS is a fileSystem whose Rename and TempFile can be made to fail.
+type faultyFS struct {
+	osFS
+	rename   func(oldpath, newpath string) error
+	tempFile func(dir, pattern string) error
+}
+
+func (fs faultyFS) Rename(oldpath, newpath string) error {
+	if fs.rename != nil {
+		if err := fs.rename(oldpath, newpath); err != nil {
+			return err
+		}
+	}
+
+	return fs.osFS.Rename(oldpath, newpath)
+}
+
+func (fs faultyFS) TempFile(dir, pattern string) (*os.File, error) {
+	if fs.tempFile != nil {
+		if err := fs.tempFile(dir, pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	return fs.osFS.TempFile(dir, pattern)
+}
+
+// withFS replaces the file system used by the writer until the returned function is called.
+func withFS(fs fileSystem) func() {
+	fsys = fs
+	return func() { fsys = osFS{} }
+}
+
+func newTestWriter(t *testing.T) *RotatingWriter {
+	dir := t.TempDir()
+
+	w, err := NewWriter(filepath.Join(dir, "app.log"))
+	require.Nil(t, err)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	w.now = func() time.Time { return now }
+	w.startDate = now
+
+	return w
+}
+
+func TestRotateRenameFailure(t *testing.T) {
+	w := newTestWriter(t)
+
+	errRename := errors.New("rename failure")
+	defer withFS(faultyFS{rename: func(oldpath, newpath string) error { return errRename }})()
+
+	_, err := w.WriteString("foo")
+	require.Nil(t, err)
+	require.Equal(t, errRename, w.Rotate())
+
+	_, err = w.WriteString("bar")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	infos, err := ioutil.ReadDir(filepath.Dir(w.filename))
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+
+	data, err := ioutil.ReadFile(w.filename)
+	require.Nil(t, err)
+	require.Equal(t, []byte("foobar"), data)
+	require.Equal(t, int64(6), w.CurrentSize())
+}
+
+func TestWriteRotationFailure(t *testing.T) {
+	w := newTestWriter(t)
+
+	now := w.now()
+	w.now = func() time.Time { return now }
+
+	var errs []error
+	w.MaxSize(1).OnError(func(err error) {
+		errs = append(errs, err)
+	})
+
+	failing := true
+	errRename := errors.New("rename failure")
+	defer withFS(faultyFS{rename: func(oldpath, newpath string) error {
+		if failing {
+			return errRename
+		}
+		return nil
+	}})()
+
+	_, err := w.WriteString("foo")
+	require.Nil(t, err)
+
+	n, err := w.Write([]byte("bar"))
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+
+	// the rotation is not retried right away.
+	n, err = w.WriteString("baz")
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+
+	require.Equal(t, []error{errRename}, errs)
+
+	data, err := ioutil.ReadFile(w.filename)
+	require.Nil(t, err)
+	require.Equal(t, []byte("foobarbaz"), data)
+
+	failing = false
+	now = now.Add(rotateRetryMin)
+
+	_, err = w.WriteString("qux")
+	require.Nil(t, err)
+	require.Len(t, errs, 1)
+
+	data, err = ioutil.ReadFile(w.makeDestName())
+	require.Nil(t, err)
+	require.Equal(t, []byte("foobarbaz"), data)
+
+	data, err = ioutil.ReadFile(w.filename)
+	require.Nil(t, err)
+	require.Equal(t, []byte("qux"), data)
+}
+
+func TestRemoveReplaceTempFile(t *testing.T) {
+	w := newTestWriter(t)
+
+	var dir, pattern string
+	restore := withFS(faultyFS{tempFile: func(d, p string) error {
+		dir, pattern = d, p
+		return nil
+	}})
+
+	_, err := w.WriteString("foo")
+	require.Nil(t, err)
+	require.Nil(t, w.Rotate())
+	require.Nil(t, w.Close())
+	restore()
+
+	// left by a crash between the creation of the temporary file and its rename.
+	f, err := ioutil.TempFile(dir, pattern)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	w, err = NewWriter(w.filename)
+	require.Nil(t, err)
+
+	_, err = w.WriteString("bar")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	_, err = os.Stat(f.Name())
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRotateCrossDevice(t *testing.T) {
+	w := newTestWriter(t)
+
+	defer withFS(faultyFS{rename: func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}})()
+
+	_, err := w.WriteString("foo")
+	require.Nil(t, err)
+	require.Nil(t, w.Rotate())
+	require.Nil(t, w.Close())
+
+	data, err := ioutil.ReadFile(w.makeDestName())
+	require.Nil(t, err)
+	require.Equal(t, []byte("foo"), data)
+
+	data, err = ioutil.ReadFile(w.filename)
+	require.Nil(t, err)
+	require.Len(t, data, 0)
+}
+
+func TestRotateCompressionDiskFull(t *testing.T) {
+	w := newTestWriter(t)
+	w.compress = true
+
+	defer withFS(faultyFS{tempFile: func(dir, pattern string) error {
+		return &os.PathError{Op: "open", Path: dir, Err: syscall.ENOSPC}
+	}})()
+
+	_, err := w.WriteString("foo")
+	require.Nil(t, err)
+
+	err = w.Rotate()
+	require.NotNil(t, err)
+	require.True(t, errors.Is(err, syscall.ENOSPC))
+	require.Nil(t, w.Close())
+
+	// the rotated file is left uncompressed.
+	data, err := ioutil.ReadFile(w.makeDestName())
+	require.Nil(t, err)
+	require.Equal(t, []byte("foo"), data)
+}
@@ -1,12 +1,21 @@
 package logr
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto"
+	"errors"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -15,255 +24,2792 @@ const (
 	TimeFormat = "2006-01-02_1504"
 )
 
+// DirMode is the permission bits used when creating the parent directories of the file.
+var DirMode os.FileMode = 0755
+
+var newline = []byte{'\n'}
+
+// readFromChunkSize is the size of the chunks read by ReadFrom.
+const readFromChunkSize = 32 * 1024
+
+// ErrClosed is returned when using a RotatingWriter which has been closed.
+var ErrClosed = errors.New("logr: writer is closed")
+
+// ErrInUse is returned when creating a RotatingWriter for a file which is already used
+// by another RotatingWriter which hasn't been closed, as they would both rotate it.
+var ErrInUse = errors.New("logr: file already used by another writer")
+
+// ErrNotRegular is returned when rotating a file which is not a regular file, such as
+// a named pipe or a device. Such files are never rotated automatically.
+var ErrNotRegular = errors.New("logr: not a regular file")
+
+// ErrDiskFull is returned by the writes when there is no space left on the device.
+var ErrDiskFull = errors.New("logr: no space left on device")
+
+// ErrNilFile is returned when creating a RotatingWriter from a nil file, and when
+// using a RotatingWriter which was not created by one of the NewWriter functions.
+var ErrNilFile = errors.New("logr: nil file")
+
+// ErrArchiveExists is returned when compressing a rotated file whose compressed file
+// already exists. The compressed file is never overwritten nor appended to, and the
+// rotated file is kept uncompressed.
+var ErrArchiveExists = errors.New("logr: compressed file already exists")
+
 // RotatingWriter is a io.Writer which wraps a *os.File, suitable for log rotation.
+//
+// It is safe for concurrent use. The configuration methods can be called at any time
+// and take effect at the next write; use Reconfigure to change several settings at once.
 type RotatingWriter struct {
-	lock        sync.Mutex
-	filename    string
-	file        *os.File
-	currentSize int64
-	startDate   time.Time
-
-	timeFormat string
-	prefix     bool
-	daily      bool
-	compress   bool
-	maxSize    int64
+	// currentSize, rotations and the other counters are accessed atomically so that
+	// reading them doesn't contend with the writes, they must stay first to be 64-bit
+	// aligned.
+	currentSize        int64
+	rotations          uint64
+	bytesWritten       uint64
+	compressionErrors  uint64
+	retentionDeletions uint64
+	droppedBytes       uint64
+
+	lock         sync.Mutex
+	filename     string
+	file         *os.File
+	callerFile   *os.File
+	currentLines int64
+	headerSize   int64
+	notRegular   bool
+	passthrough  bool
+	started      bool
+	startDate    time.Time
+	retryDelay   time.Duration
+	retryAt      time.Time
+	closed       bool
+	now          func() time.Time
+	asyncSem     chan struct{}
+	asyncJobs    sync.WaitGroup
+	compressions sync.WaitGroup
+	asyncLock    sync.Mutex
+	asyncErr     error
+	inflight     map[string]bool
+	buf          *bufio.Writer
+	timerStop    chan struct{}
+	timerDone    chan struct{}
+
+	timeFormat        string
+	prefix            bool
+	separator         string
+	seqDigits         int
+	hostname          string
+	pid               int
+	daily             bool
+	hourly            bool
+	dailyAt           *wallClock
+	utc               bool
+	interval          time.Duration
+	maxOpenAge        time.Duration
+	compress          bool
+	level             int
+	compressor        Compressor
+	extension         string
+	keepUncompressed  bool
+	compressMinSize   int64
+	compressBufSize   int
+	sequential        bool
+	nameFunc          func(filename string, t time.Time, seq int) string
+	archiveDir        string
+	partitionByDate   bool
+	copyTruncate      bool
+	keepFileOpen      bool
+	syncWrites        bool
+	dirSync           bool
+	dryRun            func(string)
+	onRotate          func(archivePath string, err error)
+	onError           func(err error)
+	symlink           string
+	dontRotateEmpty   bool
+	rotateOnOpen      bool
+	compressExisting  bool
+	header            []byte
+	fallback          io.Writer
+	tee               io.Writer
+	limiter           *tokenBucket
+	dropOverLimit     bool
+	cleanupOnDiskFull bool
+	lineTransform     func([]byte) []byte
+	checksum          crypto.Hash
+	maxSize           int64
+	maxLines          int
+	minRotateInterval time.Duration
+	rotateBeforeWrite bool
+	readSize          bool
+	reopenOnChange    bool
+	maxBackups        int
+	maxAge            time.Duration
+	maxTotalSize      int64
 }
 
-// NewWriter creates a new file and returns a rotating writer.
+// NewWriter opens the file, creating it with the 0600 permission bits if it does
+// not exist, and returns a rotating writer.
+//
+// The parent directories are created with the DirMode permission bits if needed.
+//
+// The filenames "-" and "/dev/stdout" are special: the writer then writes to os.Stdout,
+// and "/dev/stderr" to os.Stderr, without opening a file. Such a writer never rotates,
+// Rotate and Reopen do nothing, and Close doesn't close os.Stdout or os.Stderr. This
+// lets the same code log to a file or, in a container, to the standard output.
 func NewWriter(filename string) (*RotatingWriter, error) {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND, 0600)
+	switch filename {
+	case "-", "/dev/stdout":
+		return newPassthroughWriter(os.Stdout), nil
+	case "/dev/stderr":
+		return newPassthroughWriter(os.Stderr), nil
+	}
+
+	if err := fsys.MkdirAll(filepath.Dir(filename), DirMode); err != nil {
+		return nil, err
+	}
+
+	file, err := fsys.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := NewWriterFromFile(file)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
 
-	return NewWriterFromFile(file)
+	// the file is not provided by the caller, the writer owns it.
+	w.callerFile = nil
+
+	return w, nil
 }
 
 // NewWriterWithCompression creates a new file and returns a rotating writer compressing
 // the old files.
 func NewWriterWithCompression(filename string) (*RotatingWriter, error) {
 	w, err := NewWriter(filename)
+	if err != nil {
+		return nil, err
+	}
+
 	w.compress = true
-	return w, err
+
+	return w, nil
 }
 
 // NewWriterFromFile creates a rotating writer using the provided file as base.
 //
+// If the file is not empty, its start date, from which the time based rotations and
+// the name of the rotated file are computed, is its modification time instead of now.
+// See StartDate to set it explicitly.
+//
 // The caller must take care to not close the file it provides here, as the RotatingWriter
-// will do it automatically when rotating.
+// will do it automatically when rotating, unless KeepFileOpen is used.
+//
+// It returns ErrInUse if the file is already used by another writer which hasn't been closed.
+// If the file is not a regular file, such as a named pipe or a device, it is never rotated.
 func NewWriterFromFile(file *os.File) (*RotatingWriter, error) {
-	w := &RotatingWriter{
-		filename:  file.Name(),
-		file:      file,
-		maxSize:   -1,
-		startDate: time.Now(),
+	if file == nil {
+		return nil, ErrNilFile
 	}
 
+	if err := register(file.Name()); err != nil {
+		return nil, err
+	}
+
+	w := newRotatingWriter(file)
+
 	if err := w.readCurrentSize(); err != nil {
+		unregister(w.filename)
 		return nil, err
 	}
 
+	w.resetStartDate()
+
 	return w, nil
 }
 
+// resetStartDate sets the start date of the current file to now, or to its modification
+// time if it is not empty and was last written before.
+func (w *RotatingWriter) resetStartDate() {
+	w.startDate = w.currentTime()
+
+	if w.file == nil || w.notRegular {
+		return
+	}
+
+	// a file written by a previous process was started at the latest when last written,
+	// this keeps the time based rotations from being delayed by a restart.
+	if fi, err := w.file.Stat(); err == nil && fi.Size() > 0 && fi.ModTime().Before(w.startDate) {
+		w.startDate = w.inLocation(fi.ModTime())
+	}
+}
+
+// newRotatingWriter returns a rotating writer writing to file, with the default settings.
+func newRotatingWriter(file *os.File) *RotatingWriter {
+	w := &RotatingWriter{
+		filename:   file.Name(),
+		file:       file,
+		callerFile: file,
+		maxSize:    -1,
+		level:      gzip.DefaultCompression,
+		now:        time.Now,
+	}
+	w.startDate = w.currentTime()
+
+	return w
+}
+
+// newPassthroughWriter returns a writer writing to file, one of the standard output
+// or error, which is never rotated nor closed.
+func newPassthroughWriter(file *os.File) *RotatingWriter {
+	w := newRotatingWriter(file)
+	w.passthrough = true
+	w.notRegular = true
+
+	return w
+}
+
 // NewWriterFromFileWithCompression is the same as NewWriteFromFile but with
 // compression enabled.
 func NewWriterFromFileWithCompression(file *os.File) (*RotatingWriter, error) {
 	w, err := NewWriterFromFile(file)
+	if err != nil {
+		return nil, err
+	}
+
 	w.compress = true
-	return w, err
+
+	return w, nil
 }
 
-// readCurrentSize reads the current size from the file
-func (w *RotatingWriter) readCurrentSize() error {
-	fi, err := w.file.Stat()
-	if err != nil {
+// ResyncSize reads the current size from the file, after flushing the buffer if any.
+//
+// The size is normally tracked by the writes, this is useful when the file is written
+// or truncated by another process, so that the size based rotation stays accurate.
+func (w *RotatingWriter) ResyncSize() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkOpen(); err != nil {
 		return err
 	}
 
-	w.currentSize = fi.Size()
+	if w.buf != nil {
+		if err := w.buf.Flush(); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	return w.readCurrentSize()
 }
 
-// Daily set the rotating to be done each day.
-//
-// The rotating is done at (start date + 24h), not at precisely the next day.
-func (w *RotatingWriter) Daily() *RotatingWriter {
+// ReopenOnChange tells the writer to check before each write that the file it writes to
+// is still the one at its path, and to reopen it otherwise, for example when it was
+// removed by mistake, so that the logs don't go to a file which is not on disk anymore.
+// This costs two system calls per write.
+func (w *RotatingWriter) ReopenOnChange() *RotatingWriter {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	w.daily = true
+	w.reopenOnChange = true
 
 	return w
 }
 
-// MaxSize set the size at which to rotate the file
-func (w *RotatingWriter) MaxSize(s int64) *RotatingWriter {
+// reopenIfChanged reopens the file if it is not the one at its path anymore.
+func (w *RotatingWriter) reopenIfChanged() error {
+	fi, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	current, err := fsys.Stat(w.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err == nil && os.SameFile(fi, current) {
+		return nil
+	}
+
+	return w.reopen()
+}
+
+// ReadSizeBeforeWrite tells the writer to read the size of the file before each write,
+// instead of only tracking it, so that the size based rotation stays accurate when
+// other processes append to the file. This costs a system call per write.
+func (w *RotatingWriter) ReadSizeBeforeWrite() *RotatingWriter {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	w.maxSize = s
+	w.readSize = true
 
 	return w
 }
 
-// TimeFormat sets the time format to use when rolling over.
-func (w *RotatingWriter) TimeFormat(s string) *RotatingWriter {
+// reconcileSize sets the current size from the size of the file and the buffered bytes.
+func (w *RotatingWriter) reconcileSize() error {
+	fi, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := fi.Size()
+	if w.buf != nil {
+		size += int64(w.buf.Buffered())
+	}
+	atomic.StoreInt64(&w.currentSize, size)
+
+	return nil
+}
+
+// readCurrentSize reads the current size from the file
+func (w *RotatingWriter) readCurrentSize() error {
+	fi, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt64(&w.currentSize, fi.Size())
+	w.notRegular = w.passthrough || !fi.Mode().IsRegular()
+
+	return nil
+}
+
+// Filename returns the name of the file being written to.
+func (w *RotatingWriter) Filename() string {
+	// the name never changes, no need to lock.
+	return w.filename
+}
+
+// File returns the file being written to.
+//
+// It is replaced on each rotation and on Reopen, so it must not be kept. The caller
+// must not close it, and writing to it directly bypasses the size tracking and the
+// buffer if any.
+func (w *RotatingWriter) File() *os.File {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	w.timeFormat = s
+	return w.file
+}
 
-	return w
+// CurrentSize returns the size of the file being written to, including the buffered bytes.
+//
+// The size is tracked by the writes, it is only accurate if no other process writes to
+// the file, unless ReadSizeBeforeWrite is used. It doesn't wait for a write or a
+// rotation in progress.
+func (w *RotatingWriter) CurrentSize() int64 {
+	return atomic.LoadInt64(&w.currentSize)
 }
 
-// Prefix tells the writer to use the time format as prefix.
-func (w *RotatingWriter) Prefix() *RotatingWriter {
+// RotationCount returns the number of rotations done since the creation of the writer.
+//
+// It doesn't wait for a write or a rotation in progress.
+func (w *RotatingWriter) RotationCount() uint64 {
+	return atomic.LoadUint64(&w.rotations)
+}
+
+// RotateInBackground starts a goroutine rotating the file when a time based rotation is
+// due, even if nothing is written, instead of on the next write. It checks at least
+// every minute, so that changes of the settings are taken into account. Close stops it.
+func (w *RotatingWriter) RotateInBackground() *RotatingWriter {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	w.prefix = true
+	if w.timerStop == nil && !w.closed {
+		w.timerStop = make(chan struct{})
+		w.timerDone = make(chan struct{})
+		go w.rotateOnTime(w.timerStop, w.timerDone)
+	}
 
 	return w
 }
 
-func (w *RotatingWriter) Write(b []byte) (int, error) {
-	w.lock.Lock()
-	defer w.lock.Unlock()
+// rotateOnTime rotates the file when a time based rotation is due, until stop is closed.
+func (w *RotatingWriter) rotateOnTime(stop, done chan struct{}) {
+	defer close(done)
 
-	if w.daily {
-		now := time.Now()
-		if now.Day() != w.startDate.Day() {
-			if err := w.rotate(); err != nil {
-				return -1, err
+	failed := false
+	for {
+		w.lock.Lock()
+		wait := time.Minute
+		if next := w.nextRotation(); !next.IsZero() {
+			if d := next.Sub(w.currentTime()); d < wait {
+				wait = d
 			}
 		}
-	}
+		w.lock.Unlock()
+
+		// don't retry a failed rotation in a loop.
+		if failed && wait < time.Second {
+			wait = time.Second
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		w.lock.Lock()
+		// a write may have rotated the file meanwhile.
+		next := w.nextRotation()
+		if w.checkOpen() == nil && !w.notRegular && !next.IsZero() && !w.currentTime().Before(next) {
+			w.start()
 
-	if w.maxSize > -1 {
-		if w.currentSize >= w.maxSize {
-			if err := w.rotate(); err != nil {
-				return -1, err
+			err := w.rotate()
+			if err != nil {
+				w.reportError(err)
 			}
+			failed = err != nil
 		}
+		w.lock.Unlock()
 	}
+}
 
-	n, err := w.file.Write(b)
-	w.currentSize += int64(n)
+// NextRotation returns the time at which the next time based rotation is due, or the
+// zero time if the rotation is not time based.
+//
+// The rotation itself happens on the first write after this time.
+func (w *RotatingWriter) NextRotation() time.Time {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-	return n, err
+	return w.nextRotation()
 }
 
-// rotate rotates the file. must be called while having the file lock
-func (w *RotatingWriter) rotate() error {
-	if err := w.file.Close(); err != nil {
-		return err
+// nextRotation returns the earliest time at which one of the time based rotations is due.
+func (w *RotatingWriter) nextRotation() time.Time {
+	var next time.Time
+	earliest := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
 	}
 
-	{
-		destName := w.makeDestName()
-		_, err := os.Stat(destName)
-		if err != nil && !os.IsNotExist(err) {
-			return err
-		}
+	if w.daily {
+		y, m, d := w.startDate.Date()
+		earliest(time.Date(y, m, d+1, 0, 0, 0, 0, w.startDate.Location()))
+	}
 
-		if err := os.Rename(w.filename, destName); err != nil {
-			return err
+	if w.dailyAt != nil {
+		c := *w.dailyAt
+		if c.loc == nil {
+			c.loc = w.location()
 		}
+		earliest(c.next(w.startDate))
+	}
 
-		if w.compress {
-			if err := w.compressFile(destName); err != nil {
-				return err
-			}
+	if w.hourly {
+		y, m, d := w.startDate.Date()
+		earliest(time.Date(y, m, d, w.startDate.Hour()+1, 0, 0, 0, w.startDate.Location()))
+	}
 
-			// no error to compress the data and to rename it
-			// to its last filename, we can now safely remove
-			// the original uncompressed file.
-			if err := os.Remove(destName); err != nil {
-				return err
-			}
-		}
+	if w.interval > 0 {
+		earliest(w.startDate.Add(w.interval))
+	}
 
-		w.startDate = time.Now().Truncate(time.Hour * 24)
+	if w.maxOpenAge > 0 {
+		earliest(w.startDate.Add(w.maxOpenAge))
 	}
 
-	{
-		file, err := os.OpenFile(w.filename, os.O_RDWR|os.O_CREATE, 0600)
-		if err != nil {
-			return err
-		}
+	return next
+}
+
+// Stats holds counters about a RotatingWriter.
+type Stats struct {
+	// BytesWritten is the number of bytes written to the files, headers included.
+	BytesWritten uint64
+	// Rotations is the number of rotations.
+	Rotations uint64
+	// CompressionErrors is the number of rotated files which couldn't be compressed.
+	CompressionErrors uint64
+	// RetentionDeletions is the number of rotated files removed by the retention.
+	RetentionDeletions uint64
+	// DroppedBytes is the number of bytes dropped because of the rate limit.
+	DroppedBytes uint64
+	// CurrentSize is the size of the current file.
+	CurrentSize int64
+}
 
-		w.file = file
-		w.currentSize = 0
+// Stats returns the counters of the writer since its creation.
+//
+// It doesn't wait for the writes nor the rotations in progress, each counter is read
+// atomically on its own.
+func (w *RotatingWriter) Stats() Stats {
+	return Stats{
+		BytesWritten:       atomic.LoadUint64(&w.bytesWritten),
+		Rotations:          atomic.LoadUint64(&w.rotations),
+		CompressionErrors:  atomic.LoadUint64(&w.compressionErrors),
+		RetentionDeletions: atomic.LoadUint64(&w.retentionDeletions),
+		DroppedBytes:       atomic.LoadUint64(&w.droppedBytes),
+		CurrentSize:        atomic.LoadInt64(&w.currentSize),
 	}
+}
 
-	return nil
+// addWritten accounts n bytes written to the file.
+func (w *RotatingWriter) addWritten(n int) {
+	if n > 0 {
+		atomic.AddInt64(&w.currentSize, int64(n))
+		atomic.AddUint64(&w.bytesWritten, uint64(n))
+	}
 }
 
-// compressFile compresses the file at destName into a file at destName.gz
-func (w *RotatingWriter) compressFile(destName string) error {
-	var rotated, tmpFile *os.File
-	var err error
+// UTC tells the writer to use UTC instead of the local time to decide when to rotate
+// and to name the rotated files, so that all the hosts rotate at the same time
+// whatever their time zone. DailyAt still uses its location if one is given.
+func (w *RotatingWriter) UTC() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-	// open the rotated file.
-	if rotated, err = os.Open(destName); err != nil {
-		return err
+	w.utc = true
+	w.startDate = w.startDate.UTC()
+
+	return w
+}
+
+// location returns the location of the times used by the writer.
+func (w *RotatingWriter) location() *time.Location {
+	if w.utc {
+		return time.UTC
 	}
 
-	defer rotated.Close()
+	return time.Local
+}
 
-	// compress
-	if tmpFile, err = w.gzip(rotated); err != nil {
-		return err
+// inLocation returns t in UTC if UTC is used, and unchanged otherwise.
+func (w *RotatingWriter) inLocation(t time.Time) time.Time {
+	if w.utc {
+		return t.UTC()
 	}
 
-	defer tmpFile.Close()
+	return t
+}
 
-	// force close just before renaming
-	rotated.Close()
+// currentTime returns the current time according to the clock of the writer.
+func (w *RotatingWriter) currentTime() time.Time {
+	return w.inLocation(w.now())
+}
 
-	// rename the gzipped file
-	if err := os.Rename(tmpFile.Name(), destName+".gz"); err != nil {
-		return err
+// Daily set the rotating to be done each day.
+//
+// The rotating is done by the first write happening after the next midnight following
+// the start date, in the local time or in UTC if UTC is used.
+func (w *RotatingWriter) Daily() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.daily = true
+
+	return w
+}
+
+// DailyAt set the rotating to be done each day at the wall clock time hour:minute in
+// the location loc, or in the local time if loc is nil, or in UTC if UTC is used.
+//
+// Changes of daylight saving time are taken into account: if the time doesn't exist
+// on a given day, the rotating is done at the normalized time, for example 3:30 instead
+// of 2:30, and if it occurs twice the rotating is done only once. DailyAt panics if
+// hour or minute is out of range.
+func (w *RotatingWriter) DailyAt(hour, minute int, loc *time.Location) *RotatingWriter {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		panic("logr: invalid time of day")
 	}
 
-	return nil
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.dailyAt = &wallClock{hour: hour, minute: minute, loc: loc}
+
+	return w
 }
 
-func (w *RotatingWriter) gzip(src *os.File) (*os.File, error) {
-	var tmpFile *os.File
-	var err error
+// Hourly set the rotating to be done each hour.
+//
+// The rotating is done by the first write happening after the hour changed.
+func (w *RotatingWriter) Hourly() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-	// create a tmp file which will be the rotated one but compressed.
-	if tmpFile, err = ioutil.TempFile(os.TempDir(), "tmp"); err != nil {
-		return nil, err
-	}
+	w.hourly = true
 
-	// compression
-	z := gzip.NewWriter(tmpFile)
-	defer z.Close()
-	_, err = io.Copy(z, src)
-	if err != nil {
-		return nil, err
-	}
+	return w
+}
+
+// Every set the rotating to be done each time the duration d has elapsed since the
+// creation of the current file.
+//
+// It can be combined with MaxSize, in which case whichever condition is met first
+// triggers the rotation. Both are then reset, as the new file starts empty.
+func (w *RotatingWriter) Every(d time.Duration) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.interval = d
+
+	return w
+}
+
+// MaxOpenAge sets the maximum age of the current file: it is rotated on the first write
+// once d has elapsed since its creation, whatever its size.
+//
+// It behaves like Every, and is meant to bound how long a file stays open with size
+// based rotation during a low traffic period. With both, the shortest duration applies.
+func (w *RotatingWriter) MaxOpenAge(d time.Duration) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-	return tmpFile, nil
+	w.maxOpenAge = d
+
+	return w
 }
 
-func (w *RotatingWriter) makeDestName() string {
-	tf := TimeFormat
-	if w.timeFormat != "" {
-		tf = w.timeFormat
-	}
+// StartDate sets the date at which the current file was started, from which the time
+// based rotations and the name of the rotated file are computed.
+//
+// It is recomputed by Clock from the new clock and the modification time of the file,
+// so it must be called after it.
+func (w *RotatingWriter) StartDate(t time.Time) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-	if w.prefix {
-		ext := filepath.Ext(w.filename)
-		name := w.filename[:len(w.filename)-len(ext)]
+	w.startDate = w.inLocation(t)
+
+	return w
+}
+
+// Clock sets the function used to get the current time, instead of time.Now.
+//
+// The start date of the current file is recomputed using the new clock: it is now, or
+// the modification time of the file if it is not empty and was last written before.
+func (w *RotatingWriter) Clock(fn func() time.Time) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.now = fn
+	w.resetStartDate()
+
+	return w
+}
+
+// MaxSize set the size at which to rotate the file
+//
+// By default the size is checked before each write, and the file is rotated if it
+// already reached s: a write is never split, so the file can exceed s by the size of
+// the last write. See RotateBeforeWrite to never exceed s.
+func (w *RotatingWriter) MaxSize(s int64) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-		return name + "." + w.startDate.Format(tf) + ext
+	w.maxSize = s
+
+	return w
+}
+
+// MaxLines set the number of lines at which to rotate the file, lines being counted
+// as newline characters.
+//
+// Like with MaxSize, the number of lines is checked before each write. When combined
+// with MaxSize, whichever limit is reached first triggers the rotation. The lines in
+// the file when it is opened are not counted.
+func (w *RotatingWriter) MaxLines(n int) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.maxLines = n
+
+	return w
+}
+
+// MinRotateInterval sets the minimum time between the start of a file and its rotation
+// because of MaxSize or MaxLines, to avoid many small rotated files during a burst of
+// writes.
+//
+// The file then grows beyond these limits until d elapsed, and they are not a hard cap
+// anymore. The time based rotations and Rotate are not affected.
+func (w *RotatingWriter) MinRotateInterval(d time.Duration) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.minRotateInterval = d
+
+	return w
+}
+
+// RotateBeforeWrite tells the writer to rotate the file before a write which would
+// make it exceed the maximum size, instead of after.
+//
+// The file never exceeds the maximum size, unless a single write is larger than it:
+// such a write goes entirely to a new file.
+func (w *RotatingWriter) RotateBeforeWrite() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.rotateBeforeWrite = true
+
+	return w
+}
+
+// TimeFormat sets the time format to use when rolling over.
+//
+// The time format must not give a path separator, otherwise the rotations fail with
+// an error wrapping ErrInvalidConfig, which Validate also reports: use PartitionByDate
+// to put the rotated files in a directory per day.
+func (w *RotatingWriter) TimeFormat(s string) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.timeFormat = s
+
+	return w
+}
+
+// CompressionLevel sets the gzip compression level used to compress the rotated files.
+//
+// The level must be between gzip.HuffmanOnly and gzip.BestCompression, otherwise
+// CompressionLevel panics.
+func (w *RotatingWriter) CompressionLevel(level int) *RotatingWriter {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		panic("logr: invalid compression level")
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.level = level
+
+	return w
+}
+
+// CompressExisting tells the writer to compress in background, before the first write
+// or rotation, the rotated files which are not compressed. They may have been rotated
+// before the compression was enabled, or left uncompressed by a crash.
+//
+// Errors are reported to the OnError function and returned by Close.
+func (w *RotatingWriter) CompressExisting() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.compressExisting = true
+
+	return w
+}
+
+// Compressor sets the Compressor used to compress the rotated files, and enables
+// the compression.
+//
+// By default the rotated files are compressed with gzip, using the ".gz" extension.
+func (w *RotatingWriter) Compressor(c Compressor) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.compress = true
+	w.compressor = c
+
+	return w
+}
+
+// CompressExtension sets the extension appended to the name of the compressed files,
+// including the leading dot, overriding the one of the Compressor.
+func (w *RotatingWriter) CompressExtension(ext string) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.extension = ext
+
+	return w
+}
+
+// CompressBufferSize sets the size of the buffers used to read the rotated files and to
+// write the compressed files, which are larger than the default ones with a large n,
+// reducing the number of system calls. A value of 0 or less uses the default buffers
+// of the Compressor.
+func (w *RotatingWriter) CompressBufferSize(n int) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.compressBufSize = n
+
+	return w
+}
+
+// getCompressor returns the Compressor used to compress the rotated files.
+func (w *RotatingWriter) getCompressor() Compressor {
+	var c Compressor = gzipCompressor{level: w.level}
+	if w.compressor != nil {
+		c = w.compressor
+	}
+
+	if w.compressBufSize > 0 {
+		c = bufferedCompressor{Compressor: c, size: w.compressBufSize}
+	}
+
+	if w.extension != "" {
+		return extensionCompressor{Compressor: c, extension: w.extension}
+	}
+
+	return c
+}
+
+// KeepUncompressed tells the writer to keep the rotated files once compressed, so that
+// both the uncompressed and the compressed files are available.
+//
+// The retention removes both files together, and counts them as one rotated file.
+func (w *RotatingWriter) KeepUncompressed() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.keepUncompressed = true
+
+	return w
+}
+
+// CompressMinSize sets the minimum size, in bytes, of the rotated files to compress.
+// The smaller ones are left uncompressed, compressing them is not worth it.
+func (w *RotatingWriter) CompressMinSize(s int64) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.compressMinSize = s
+
+	return w
+}
+
+// AsyncCompression tells the writer to compress the rotated files in background,
+// so that writes are not blocked while compressing.
+//
+// At most n compressions run concurrently; when this limit is reached, rotating
+// blocks until a compression finishes. Close waits for the pending compressions.
+func (w *RotatingWriter) AsyncCompression(n int) *RotatingWriter {
+	if n <= 0 {
+		panic("logr: invalid number of concurrent compressions")
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.asyncSem = make(chan struct{}, n)
+
+	return w
+}
+
+// SequentialNaming tells the writer to name the rotated files with a sequence number
+// instead of the time: the newest rotated file is always named filename.1, and
+// when rotating, filename.1 is renamed to filename.2 and so on.
+//
+// Prefix and TimeFormat have no effect in this mode, and MaxAge uses the modification
+// time of the rotated files.
+func (w *RotatingWriter) SequentialNaming() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.sequential = true
+
+	return w
+}
+
+// NameFunc sets the function used to generate the name of the rotated files.
+//
+// fn is called with the name of the file, the date at which it was created and a
+// sequence number, starting at 0, which is incremented until fn returns a name which
+// is not already used. The name can be in another directory, which is created with
+// the DirMode permission bits if needed.
+//
+// Prefix and TimeFormat have no effect when a NameFunc is set, and MaxBackups and
+// MaxAge only apply to the rotated files named using the default naming.
+func (w *RotatingWriter) NameFunc(fn func(filename string, t time.Time, seq int) string) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.nameFunc = fn
+
+	return w
+}
+
+// ArchiveDir tells the writer to move the rotated files to the directory dir, which
+// is created with the DirMode permission bits if needed.
+//
+// The directory can be on another file system than the file.
+func (w *RotatingWriter) ArchiveDir(dir string) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.archiveDir = dir
+
+	return w
+}
+
+// PartitionByDate tells the writer to move the rotated files to subdirectories of the
+// archive directory, or of the directory of the file, named after the date at which
+// they were created, like 2006/01/02/app.log.2006-01-02_1504. The subdirectories are
+// created with the DirMode permission bits if needed, and removed by the retention
+// once empty.
+//
+// It has no effect with SequentialNaming or a NameFunc.
+func (w *RotatingWriter) PartitionByDate() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.partitionByDate = true
+
+	return w
+}
+
+// SyncWrites tells the writer to open the file with the O_SYNC flag, so that each write
+// returns once the data is on disk, without calling Sync.
+//
+// This makes the writes much slower, each one waiting for the disk, and is meant for
+// the logs which must not be lost. The file is reopened immediately, errors doing so
+// are reported to the OnError function.
+func (w *RotatingWriter) SyncWrites() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.syncWrites = true
+
+	if w.checkOpen() == nil {
+		if err := w.reopen(); err != nil {
+			w.reportError(err)
+		}
+	}
+
+	return w
+}
+
+// DryRun tells the writer to report with fn the rotations and the removals of rotated
+// files it would do, without doing them, to check the configuration against the
+// existing files.
+//
+// The writes still go to the file, which is never rotated, but the rotations are
+// decided as if it was: the size and the date of the file are reset.
+func (w *RotatingWriter) DryRun(fn func(action string)) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.dryRun = fn
+
+	return w
+}
+
+// DirSync tells the writer to commit to stable storage the directories of the file
+// and of the rotated files after each rotation and compression, so that the renamed
+// and created files are not lost in case of a crash.
+func (w *RotatingWriter) DirSync() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.dirSync = true
+
+	return w
+}
+
+// KeepFileOpen tells the writer to never close the file provided to NewWriterFromFile,
+// so that the caller can keep using it, and has to close it.
+//
+// The writer still stops writing to it on rotation and on Reopen, and opens the new
+// file by its name. With CopyTruncate the file is truncated and kept in use instead.
+func (w *RotatingWriter) KeepFileOpen() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.keepFileOpen = true
+
+	return w
+}
+
+// checkOpen returns an error if the writer can't be used.
+func (w *RotatingWriter) checkOpen() error {
+	if w.closed {
+		return ErrClosed
+	}
+
+	if w.file == nil {
+		return ErrNilFile
+	}
+
+	return nil
+}
+
+// closeFile closes the file, unless it is the one provided by the caller and it must
+// be kept open.
+func (w *RotatingWriter) closeFile() error {
+	if w.passthrough || (w.keepFileOpen && w.file == w.callerFile) {
+		return nil
+	}
+
+	return w.file.Close()
+}
+
+// CopyTruncate tells the writer to rotate by copying the file then truncating it,
+// instead of renaming it and creating a new one.
+//
+// The file is never closed, which is useful when other processes or libraries hold
+// the file open. Some data written by them during the copy may be lost.
+func (w *RotatingWriter) CopyTruncate() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.copyTruncate = true
+
+	return w
+}
+
+// Buffered tells the writer to buffer the writes in a buffer of size bytes, reducing
+// the number of system calls.
+//
+// The buffer is flushed when it is full, when rotating, and by Sync and Close. The
+// buffered bytes count in the size of the file.
+func (w *RotatingWriter) Buffered(size int) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.buf != nil {
+		w.buf.Flush()
+	}
+	w.buf = bufio.NewWriterSize(w.file, size)
+
+	return w
+}
+
+// OnRotate sets a function called after each rotation with the path of the rotated
+// file, which is the compressed one if compression is enabled.
+//
+// If the compression failed, fn is called with the path of the uncompressed file and
+// the error. With asynchronous compression, fn is called from another goroutine once
+// the compression is done; otherwise it is called while holding the lock of the
+// writer, so it must not call its methods.
+func (w *RotatingWriter) OnRotate(fn func(archivePath string, err error)) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.onRotate = fn
+
+	return w
+}
+
+// OnError sets a function called with the errors which may go unnoticed: the errors
+// of the rotations triggered by Write, after which the data is still written to the
+// current file, and the errors of the asynchronous compressions, which are also
+// returned by Close.
+//
+// Errors of Rotate, Reopen, Sync and Close are only returned to the caller. fn may be
+// called while holding the lock of the writer, so it must not call its methods.
+func (w *RotatingWriter) OnError(fn func(err error)) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.onError = fn
+
+	return w
+}
+
+// Symlink tells the writer to maintain a symbolic link at path pointing to the file.
+//
+// The link is created immediately and updated after each rotation. Errors are reported
+// to the OnError function.
+func (w *RotatingWriter) Symlink(path string) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.symlink = path
+	if err := w.updateSymlink(); err != nil {
+		w.reportError(err)
+	}
+
+	return w
+}
+
+// updateSymlink atomically replaces the symbolic link, if any, with a new one
+// pointing to the file.
+func (w *RotatingWriter) updateSymlink() error {
+	if w.symlink == "" {
+		return nil
+	}
+
+	target, err := filepath.Abs(w.filename)
+	if err != nil {
+		return err
+	}
+
+	tmp := w.symlink + ".tmp"
+	fsys.Remove(tmp)
+
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+
+	return fsys.Rename(tmp, w.symlink)
+}
+
+// DontRotateEmpty tells the writer to not rotate the file if it is empty, including
+// when calling Rotate. The start date of the file is still reset, as if it was rotated.
+func (w *RotatingWriter) DontRotateEmpty() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.dontRotateEmpty = true
+
+	return w
+}
+
+// RotateOnOpen tells the writer to rotate the file before the first write if it is not
+// empty, so that each process writes to its own file. The rotated file is named using
+// the modification time of the file, which is when its content was last written.
+//
+// It must be called before the first write.
+func (w *RotatingWriter) RotateOnOpen() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.rotateOnOpen = true
+
+	return w
+}
+
+// Header sets the data written at the beginning of each file, before the first write
+// to it, so that each rotated file can be parsed independently.
+//
+// The header counts in the size of the file but not in its number of lines. A file
+// containing only the header is considered empty by DontRotateEmpty.
+func (w *RotatingWriter) Header(b []byte) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.header = append([]byte(nil), b...)
+
+	return w
+}
+
+// FallbackWriter sets a writer receiving the data which couldn't be written to the
+// file, for example os.Stderr.
+//
+// Write still returns the original error, the errors of the fallback writer are ignored.
+func (w *RotatingWriter) FallbackWriter(fw io.Writer) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.fallback = fw
+
+	return w
+}
+
+// FreeSpaceOnDiskFull tells the writer, when a write fails because there is no space
+// left on the device, to remove the rotated files not to be retained according to
+// MaxBackups, MaxAge and MaxTotalSize, and to retry the write once.
+func (w *RotatingWriter) FreeSpaceOnDiskFull() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.cleanupOnDiskFull = true
+
+	return w
+}
+
+// Tee sets a writer to which the data written to the file is also written, such as
+// os.Stdout. The errors of tw are reported to the OnError function and don't fail
+// the writes. The header is not written to tw.
+func (w *RotatingWriter) Tee(tw io.Writer) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.tee = tw
+
+	return w
+}
+
+// LineTransform sets a function transforming each line before it is written to the
+// file, for example the one of TimestampTransform. The line passed to fn ends with a newline,
+// except the last one of a write if it doesn't end with one, and fn must keep it.
+//
+// Each write is expected to contain whole lines. The size of the file is the size of
+// the transformed lines. Write returns the length of the original data on success,
+// and 0 on error since the number of bytes written doesn't match it.
+func (w *RotatingWriter) LineTransform(fn func(line []byte) []byte) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.lineTransform = fn
+
+	return w
+}
+
+// TimestampTransform returns a line transformation for LineTransform prefixing each
+// line with the current time of the writer, see Clock and UTC, formatted using layout,
+// such as time.RFC3339, and a space. It must only be used by the writer itself.
+func (w *RotatingWriter) TimestampTransform(layout string) func(line []byte) []byte {
+	return func(line []byte) []byte {
+		b := make([]byte, 0, len(layout)+1+len(line))
+		b = w.currentTime().AppendFormat(b, layout)
+		b = append(b, ' ')
+		return append(b, line...)
+	}
+}
+
+// SequenceNumbers tells the writer to always append to the name of the rotated files a
+// sequence number, padded with zeros to digits digits, following the one of the last
+// rotated file having the same date. With a time format holding only the date, such
+// as "2006-01-02", the rotated files are named like app.log.2006-01-02.001,
+// app.log.2006-01-02.002 and so on, the sequence restarting every day.
+//
+// It has no effect with SequentialNaming or a NameFunc.
+func (w *RotatingWriter) SequenceNumbers(digits int) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.seqDigits = digits
+
+	return w
+}
+
+// Separator sets the separator between the name of the file and the date in the name of
+// the rotated files, "." by default. It has no effect with SequentialNaming.
+func (w *RotatingWriter) Separator(sep string) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.separator = sep
+
+	return w
+}
+
+// IncludeHostname tells the writer to put the hostname after the date in the names of
+// the rotated files, as in app.log.2006-01-02.host1, so that several hosts can share
+// the same directory. It is put before the process ID if IncludePID is used.
+//
+// Only the rotated files with the same hostname are then subject to the retention. The
+// hostname is not included if it can't be determined. It is ignored with
+// SequentialNaming and NameFunc.
+func (w *RotatingWriter) IncludeHostname() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	hostname, _ := os.Hostname()
+	w.hostname = strings.NewReplacer("/", "_", `\`, "_").Replace(hostname)
+
+	return w
+}
+
+// IncludePID tells the writer to put the process ID after the date in the names of
+// the rotated files, as in app.log.2006-01-02.12345, so that several processes can
+// share the same directory.
+//
+// Only the rotated files with the same process ID are then subject to the retention.
+// It is ignored with SequentialNaming and NameFunc.
+func (w *RotatingWriter) IncludePID() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.pid = os.Getpid()
+
+	return w
+}
+
+// Prefix tells the writer to use the time format as prefix, putting the date before the
+// extension of the file instead of after it: app.log is rotated to
+// app.2006-01-02_1504.log, and a sequence number is put before the extension too, as in
+// app.2006-01-02_1504.1.log.
+//
+// Only the last extension is considered, app.log.txt is rotated to
+// app.log.2006-01-02_1504.txt. If the file has no extension, such as applog or
+// .applog, the date is put at the end as without Prefix.
+func (w *RotatingWriter) Prefix() *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.prefix = true
+
+	return w
+}
+
+func (w *RotatingWriter) Write(b []byte) (int, error) {
+	return w.writeLocked(b)
+}
+
+// writeLocked waits for the rate limit and writes b to the file while holding the
+// lock. Write and WriteString both go through it.
+func (w *RotatingWriter) writeLocked(b []byte) (int, error) {
+	if !w.limit(len(b)) {
+		return len(b), nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkOpen(); err != nil {
+		return 0, err
+	}
+
+	if w.lineTransform != nil {
+		return w.writeTransformed(b)
+	}
+
+	return w.write(b)
+}
+
+// write writes b to the file, rotating it before if needed.
+func (w *RotatingWriter) write(b []byte) (int, error) {
+	w.rotateIfNeeded(len(b))
+
+	if err := w.writeHeader(); err != nil {
+		w.writeFallback(b)
+		return 0, err
+	}
+
+	n, err := w.writer().Write(b)
+	w.written(b[:n])
+
+	if err != nil {
+		return w.writeFailed(b, n, err)
+	}
+
+	return n, nil
+}
+
+// written accounts the data b written to the file.
+func (w *RotatingWriter) written(b []byte) {
+	w.addWritten(len(b))
+	w.currentLines += int64(bytes.Count(b, newline))
+	w.writeTee(b)
+}
+
+// writeFailed handles the error err of a write of b which wrote only n bytes. If the
+// disk is full, it removes the rotated files not to be retained and retries once if
+// FreeSpaceOnDiskFull is used, and returns ErrDiskFull if it still is.
+func (w *RotatingWriter) writeFailed(b []byte, n int, err error) (int, error) {
+	if errors.Is(err, syscall.ENOSPC) {
+		if w.cleanupOnDiskFull && w.cleanup() == nil {
+			var m int
+			m, err = w.writer().Write(b[n:])
+			w.written(b[n : n+m])
+			n += m
+		}
+
+		if errors.Is(err, syscall.ENOSPC) {
+			err = ErrDiskFull
+		}
+	}
+
+	if err != nil {
+		w.writeFallback(b[n:])
+	}
+
+	return n, err
+}
+
+// WriteString is like Write but writes the content of s. It implements io.StringWriter.
+func (w *RotatingWriter) WriteString(s string) (int, error) {
+	return w.writeLocked([]byte(s))
+}
+
+// WriteLine is like Write but appends a newline to b if it doesn't end with one, so that
+// b is written as a single line. An empty b writes an empty line.
+//
+// The number of bytes written includes the appended newline. b is not modified.
+func (w *RotatingWriter) WriteLine(b []byte) (int, error) {
+	if len(b) == 0 || b[len(b)-1] != '\n' {
+		line := make([]byte, len(b)+1)
+		copy(line, b)
+		line[len(b)] = '\n'
+		b = line
+	}
+
+	return w.Write(b)
+}
+
+// WriteTo writes the content of the current file to dst, after flushing the buffer if
+// any. It implements io.WriterTo.
+//
+// The writes and the rotations wait until it returns, so dst should be fast. The file
+// must have been opened for reading, which is the case when using NewWriter.
+func (w *RotatingWriter) WriteTo(dst io.Writer) (int64, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkOpen(); err != nil {
+		return 0, err
+	}
+
+	if w.buf != nil {
+		if err := w.buf.Flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	fi, err := w.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// reading at offsets doesn't move the position of the file.
+	return io.Copy(dst, io.NewSectionReader(w.file, 0, fi.Size()))
+}
+
+// writeTransformed writes b to the file once each of its lines transformed.
+func (w *RotatingWriter) writeTransformed(b []byte) (int, error) {
+	var t []byte
+	for rest := b; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n') + 1
+		if i == 0 {
+			i = len(rest)
+		}
+
+		t = append(t, w.lineTransform(rest[:i])...)
+		rest = rest[i:]
+	}
+
+	n, err := w.write(t)
+	if err != nil {
+		// the number of bytes written doesn't match b anymore.
+		if n > 0 {
+			n = 0
+		}
+		return n, err
+	}
+
+	return len(b), nil
+}
+
+// writeTee writes the data written to the file to the tee writer, if any. Its errors
+// are reported to the OnError function.
+func (w *RotatingWriter) writeTee(b []byte) {
+	if w.tee == nil || len(b) == 0 {
+		return
+	}
+
+	if _, err := w.tee.Write(b); err != nil {
+		w.reportError(err)
+	}
+}
+
+// writeFallback writes the data which couldn't be written to the file to the fallback
+// writer, if any. Its errors are ignored, the caller gets the original error.
+func (w *RotatingWriter) writeFallback(b []byte) {
+	if w.fallback != nil {
+		w.fallback.Write(b)
+	}
+}
+
+// writeHeader writes the header, if any, if the file is empty.
+func (w *RotatingWriter) writeHeader() error {
+	if len(w.header) == 0 || w.currentSize > 0 {
+		return nil
+	}
+
+	n, err := w.writer().Write(w.header)
+	w.addWritten(n)
+	w.headerSize = int64(n)
+
+	return err
+}
+
+// ReadFrom reads data from r until EOF and writes it to the file, rotating it when
+// needed between two chunks of data. It implements io.ReaderFrom.
+//
+// Each chunk ends at the last newline read, so that the lines are not split between
+// two writes, which matters with MaxLines and LineTransform. Only the lines longer
+// than 32 KiB are split.
+//
+// The lock is not held while reading from r, so concurrent writes can be interleaved
+// between two chunks.
+func (w *RotatingWriter) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, readFromChunkSize)
+
+	var total int64
+	for pending := 0; ; {
+		nr, rerr := r.Read(buf[pending:])
+		end := pending + nr
+
+		// keep the last partial line for the next chunk, unless it fills the buffer.
+		n := bytes.LastIndexByte(buf[:end], '\n') + 1
+		if rerr != nil || (n == 0 && end == len(buf)) {
+			n = end
+		}
+
+		if n > 0 {
+			nw, err := w.Write(buf[:n])
+			if nw > 0 {
+				total += int64(nw)
+			}
+			if err != nil {
+				return total, err
+			}
+			if nw != n {
+				return total, io.ErrShortWrite
+			}
+		}
+
+		pending = copy(buf, buf[n:end])
+
+		if rerr == io.EOF {
+			return total, nil
+		}
+		if rerr != nil {
+			return total, rerr
+		}
+	}
+}
+
+const (
+	// rotateRetryMin and rotateRetryMax bound the delay before retrying a rotation
+	// which failed during a write.
+	rotateRetryMin = time.Second
+	rotateRetryMax = time.Minute
+)
+
+// rotateIfNeeded rotates the file if needed before writing n bytes.
+//
+// If the rotation fails, the error is reported to the OnError function and the data
+// is written to the current file: losing it would be worse than a file exceeding its
+// limits. The rotation is then retried after a delay doubling after each failure.
+func (w *RotatingWriter) rotateIfNeeded(n int) {
+	if w.notRegular {
+		return
+	}
+
+	w.start()
+
+	if w.reopenOnChange {
+		if err := w.reopenIfChanged(); err != nil {
+			w.reportError(err)
+		}
+	}
+
+	if w.readSize {
+		if err := w.reconcileSize(); err != nil {
+			w.reportError(err)
+		}
+	}
+
+	if w.rotateOnOpen {
+		w.rotateOnOpen = false
+
+		if w.currentSize > 0 {
+			w.rotated(w.rotateExisting())
+			return
+		}
+	}
+
+	if w.currentTime().Before(w.retryAt) || !w.shouldRotate(n) {
+		return
+	}
+
+	w.rotated(w.rotate())
+}
+
+// rotated records the result of a rotation triggered by a write, delaying the next
+// one if it failed.
+func (w *RotatingWriter) rotated(err error) {
+	if err == nil {
+		w.retryDelay = 0
+		w.retryAt = time.Time{}
+		return
+	}
+
+	w.reportError(err)
+
+	w.retryDelay *= 2
+	if w.retryDelay < rotateRetryMin {
+		w.retryDelay = rotateRetryMin
+	}
+	if w.retryDelay > rotateRetryMax {
+		w.retryDelay = rotateRetryMax
+	}
+	w.retryAt = w.currentTime().Add(w.retryDelay)
+}
+
+// start takes care of the rotated files left by the previous runs, the first time it
+// is called. must be called while having the file lock
+func (w *RotatingWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	if err := w.removeTempFiles(); err != nil {
+		w.reportError(err)
+	}
+
+	// the rotated files may never be removed otherwise if the file is rarely rotated.
+	if err := w.cleanup(); err != nil {
+		w.reportError(err)
+	}
+
+	if w.compressExisting && w.compress {
+		if err := w.compressArchives(); err != nil {
+			w.reportError(err)
+		}
+	}
+}
+
+// rotateExisting rotates the content which was in the file before it was opened,
+// naming it using the modification time of the file.
+func (w *RotatingWriter) rotateExisting() error {
+	fi, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	w.startDate = w.inLocation(fi.ModTime())
+
+	return w.rotate()
+}
+
+// shouldRotate returns true if the file must be rotated before writing n bytes.
+func (w *RotatingWriter) shouldRotate(n int) bool {
+	if next := w.nextRotation(); !next.IsZero() && !w.currentTime().Before(next) {
+		return true
+	}
+
+	// the size and the number of lines can exceed their limit for a while.
+	if w.minRotateInterval > 0 && w.currentTime().Before(w.startDate.Add(w.minRotateInterval)) {
+		return false
+	}
+
+	if w.maxLines > 0 && w.currentLines >= int64(w.maxLines) {
+		return true
+	}
+
+	return w.maxSize > -1 && w.exceedsMaxSize(n)
+}
+
+// reportError calls the OnError function, if any, with err.
+func (w *RotatingWriter) reportError(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// exceedsMaxSize returns true if the file must be rotated before writing n bytes.
+func (w *RotatingWriter) exceedsMaxSize(n int) bool {
+	if w.rotateBeforeWrite {
+		return w.currentSize > 0 && w.currentSize+int64(n) > w.maxSize
+	}
+
+	return w.currentSize >= w.maxSize
+}
+
+// Rotate forces a rotation of the file, regardless of the size and daily settings.
+//
+// The rotation is done even if the current file is empty, producing an empty archive,
+// unless DontRotateEmpty is used. It returns ErrNotRegular if the file is not a
+// regular file.
+func (w *RotatingWriter) Rotate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkOpen(); err != nil {
+		return err
+	}
+
+	if w.passthrough {
+		return nil
+	}
+	if w.notRegular {
+		return ErrNotRegular
+	}
+
+	w.start()
+
+	return w.rotate()
+}
+
+// Sync commits the current content of the file to stable storage, flushing the
+// buffer first if writes are buffered.
+func (w *RotatingWriter) Sync() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkOpen(); err != nil {
+		return err
+	}
+
+	return w.sync()
+}
+
+// Flush writes the buffered data to the file, if writes are buffered, without
+// committing it to stable storage as Sync does. The buffer is also flushed before
+// each rotation.
+func (w *RotatingWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkOpen(); err != nil {
+		return err
+	}
+
+	if w.buf == nil {
+		return nil
+	}
+
+	return w.buf.Flush()
+}
+
+// sync flushes the buffer if any and syncs the file. must be called while having the file lock
+func (w *RotatingWriter) sync() error {
+	if w.buf != nil {
+		if err := w.buf.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// pipes and devices usually don't support it.
+	if w.notRegular {
+		return nil
+	}
+
+	return w.file.Sync()
+}
+
+// writer returns the writer to write to, which is the buffer if any or the file.
+func (w *RotatingWriter) writer() io.Writer {
+	if w.buf != nil {
+		return w.buf
+	}
+
+	return w.file
+}
+
+// setFile replaces the file. must be called while having the file lock
+func (w *RotatingWriter) setFile(file *os.File) {
+	w.file = file
+	if w.buf != nil {
+		w.buf.Reset(file)
+	}
+}
+
+// Close flushes the buffer if any, syncs and closes the underlying file.
+//
+// If compression is asynchronous, Close waits for the pending compressions and
+// returns the first error encountered by one of them, if any.
+//
+// Any subsequent call to Write or Rotate will return ErrClosed. Calling Close
+// more than once is safe and returns nil.
+func (w *RotatingWriter) Close() error {
+	return w.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but stops waiting for the pending compressions when
+// ctx is done, in which case it returns ctx.Err(), joined with the error of closing
+// the file if any. The compressions still run to completion in background.
+func (w *RotatingWriter) CloseContext(ctx context.Context) error {
+	w.lock.Lock()
+
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	if w.file == nil {
+		w.lock.Unlock()
+		return ErrNilFile
+	}
+	w.closed = true
+	timerStop, timerDone := w.timerStop, w.timerDone
+
+	if !w.passthrough {
+		unregister(w.filename)
+	}
+
+	err := w.sync()
+	if cerr := w.closeFile(); err == nil {
+		err = cerr
+	}
+
+	w.lock.Unlock()
+
+	if timerStop != nil {
+		close(timerStop)
+		<-timerDone
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.asyncJobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err != nil {
+			return errors.Join(err, ctx.Err())
+		}
+		return ctx.Err()
+	}
+
+	w.asyncLock.Lock()
+	defer w.asyncLock.Unlock()
+
+	if err == nil {
+		err = w.asyncErr
+	}
+
+	return err
+}
+
+// Reopen closes the file and opens it again by its name, creating it if it does not exist.
+//
+// This is useful when the file is rotated by an external tool such as logrotate,
+// typically when receiving SIGHUP.
+func (w *RotatingWriter) Reopen() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.checkOpen(); err != nil {
+		return err
+	}
+
+	if w.passthrough {
+		return nil
+	}
+
+	return w.reopen()
+}
+
+// reopen closes the file and opens it again. must be called while having the file lock
+func (w *RotatingWriter) reopen() error {
+	w.headerSize = 0
+
+	if w.buf != nil {
+		if err := w.buf.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fi, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	file, err := w.openFile(fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	w.setFile(file)
+
+	return w.readCurrentSize()
+}
+
+// openFile opens the file for appending, creating it with the permissions mode if
+// it does not exist.
+func (w *RotatingWriter) openFile(mode os.FileMode) (*os.File, error) {
+	flag := os.O_RDWR | os.O_APPEND | os.O_CREATE
+	if w.syncWrites {
+		flag |= os.O_SYNC
+	}
+
+	return fsys.OpenFile(w.filename, flag, mode)
+}
+
+// rotate rotates the file. must be called while having the file lock
+func (w *RotatingWriter) rotate() error {
+	if w.dontRotateEmpty && w.currentSize == w.headerSize {
+		// the next file starts now.
+		w.startDate = w.currentTime()
+		return nil
+	}
+
+	// make sure the archive is complete on disk.
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	if w.dryRun != nil {
+		return w.dryRotate()
+	}
+
+	destName, err := w.nextDestName()
+	if err != nil {
+		return err
+	}
+
+	if err := fsys.MkdirAll(filepath.Dir(destName), DirMode); err != nil {
+		return err
+	}
+
+	if w.copyTruncate {
+		err = w.copyAndTruncate(destName)
+	} else {
+		err = w.renameAndCreate(destName)
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.dirSync {
+		if err := w.syncDirs(destName); err != nil {
+			return err
+		}
+	}
+
+	w.startDate = w.currentTime()
+	atomic.StoreInt64(&w.currentSize, 0)
+	w.currentLines = 0
+	w.headerSize = 0
+	atomic.AddUint64(&w.rotations, 1)
+
+	if err := w.updateSymlink(); err != nil {
+		return err
+	}
+
+	if w.compress && w.asyncSem != nil {
+		w.compressAsync(destName)
+	} else {
+		archivePath, err := w.archiver().archive(destName)
+		notifyRotate(w.onRotate, archivePath, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.cleanup()
+}
+
+// syncDirs commits the directories of the file and of destName to stable storage.
+func (w *RotatingWriter) syncDirs(destName string) error {
+	dir := filepath.Dir(w.filename)
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+
+	if destDir := filepath.Dir(destName); destDir != dir {
+		return syncDir(destDir)
+	}
+
+	return nil
+}
+
+// dryRotate reports what rotate would do, without touching the files, and updates the
+// state of the writer as if the file was rotated.
+func (w *RotatingWriter) dryRotate() error {
+	var destName string
+	if w.sequential {
+		if err := w.shiftArchives(); err != nil {
+			return err
+		}
+		destName = w.archivePath() + ".1"
+	} else {
+		var err error
+		if destName, err = w.nextDestName(); err != nil {
+			return err
+		}
+	}
+
+	w.dryRun("rename " + w.filename + " to " + destName)
+	if w.compress {
+		w.dryRun("compress " + destName)
+	}
+
+	w.startDate = w.currentTime()
+	atomic.StoreInt64(&w.currentSize, 0)
+	w.currentLines = 0
+	w.headerSize = 0
+	atomic.AddUint64(&w.rotations, 1)
+
+	return w.cleanup()
+}
+
+// renameAndCreate renames the file to destName and creates a new file.
+//
+// If it fails, the file is reopened so that the writes can continue.
+func (w *RotatingWriter) renameAndCreate(destName string) error {
+	// the new file is created with the same permissions as the current one.
+	fi, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	mode := fi.Mode().Perm()
+
+	if w.linkAndReplace(destName, mode) == nil {
+		// the rotation is done, the current file only has to be replaced by the new one.
+		if err := w.closeFile(); err != nil {
+			w.reportError(err)
+		}
+
+		file, err := w.openFile(mode)
+		if err != nil {
+			return w.reopenAfterFailure(mode, err)
+		}
+
+		w.setFile(file)
+
+		return nil
+	}
+
+	if err := w.closeFile(); err != nil {
+		return w.reopenAfterFailure(mode, err)
+	}
+
+	if err := renameFile(w.filename, destName); err != nil {
+		return w.reopenAfterFailure(mode, err)
+	}
+
+	file, err := w.openFile(mode)
+	if err != nil {
+		// put the file back, best effort.
+		renameFile(destName, w.filename)
+		return w.reopenAfterFailure(mode, err)
+	}
+
+	w.setFile(file)
+
+	// the umask may have restricted the permissions, this is not worth failing the rotation.
+	if err := file.Chmod(mode); err != nil {
+		w.reportError(err)
+	}
+
+	return nil
+}
+
+// linkAndReplace links the file to destName then replaces it with a new empty file
+// with the permissions mode, so that the file always exists for the processes opening
+// it by name. The file is left untouched on error, for instance when hard links are not
+// supported or when destName is on another file system.
+func (w *RotatingWriter) linkAndReplace(destName string, mode os.FileMode) error {
+	// named after destName so that removeTempFiles removes it after a crash.
+	tmpFile, err := fsys.TempFile(filepath.Dir(w.filename), tmpPrefix(destName))
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+
+	err = tmpFile.Chmod(mode)
+	if cerr := tmpFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fsys.Remove(tmpName)
+		return err
+	}
+
+	if err := fsys.Link(w.filename, destName); err != nil {
+		fsys.Remove(tmpName)
+		return err
+	}
+
+	if err := fsys.Rename(tmpName, w.filename); err != nil {
+		fsys.Remove(destName)
+		fsys.Remove(tmpName)
+		return err
+	}
+
+	return nil
+}
+
+// reopenAfterFailure opens the file after a failed rotation closed it, so that the
+// writes can continue. It returns err, the error which made the rotation fail.
+func (w *RotatingWriter) reopenAfterFailure(mode os.FileMode, err error) error {
+	file, oerr := w.openFile(mode)
+	if oerr != nil {
+		return err
+	}
+
+	w.setFile(file)
+	w.readCurrentSize()
+
+	return err
+}
+
+// copyAndTruncate copies the file to destName and truncates it, keeping it open.
+func (w *RotatingWriter) copyAndTruncate(destName string) error {
+	if err := copyFile(w.filename, destName); err != nil {
+		return err
+	}
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+
+	// the file may not have been opened for appending.
+	_, err := w.file.Seek(0, io.SeekStart)
+
+	return err
+}
+
+// compressAsync compresses the file at destName in background.
+//
+// It blocks if the maximum number of concurrent compressions is reached.
+func (w *RotatingWriter) compressAsync(destName string) {
+	a := w.archiver()
+	onRotate := w.onRotate
+	onError := w.onError
+
+	// the semaphore is replaced if AsyncCompression is called again, the slot must be
+	// released to the one it was taken from.
+	sem := w.asyncSem
+	sem <- struct{}{}
+	w.asyncJobs.Add(1)
+	w.compressions.Add(1)
+	w.startCompression(destName)
+
+	go func() {
+		defer w.asyncJobs.Done()
+
+		archivePath, err := a.archive(destName)
+		rerr := w.endCompression(destName, archivePath, a)
+
+		// the callbacks may use the writer, the rotations waiting for the compressions
+		// must not wait for them.
+		<-sem
+		w.compressions.Done()
+
+		notifyRotate(onRotate, archivePath, err)
+
+		if err != nil {
+			w.reportAsyncError(onError, err)
+		}
+		if rerr != nil {
+			w.reportAsyncError(onError, rerr)
+		}
+	}()
+}
+
+// compressArchives compresses in background the rotated files which are not compressed.
+func (w *RotatingWriter) compressArchives() error {
+	archives, err := w.listArchives()
+	if err != nil {
+		return err
+	}
+
+	c := w.getCompressor()
+	keep := w.keepUncompressed
+	onError := w.onError
+
+	var names []string
+	for _, a := range archives {
+		if !strings.HasSuffix(a.path, c.Extension()) && a.size >= w.compressMinSize {
+			names = append(names, a.path)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	if w.dryRun != nil {
+		for _, name := range names {
+			w.dryRun("compress " + name)
+		}
+		return nil
+	}
+
+	a := w.archiver()
+
+	w.asyncJobs.Add(1)
+	w.compressions.Add(1)
+	for _, name := range names {
+		w.startCompression(name)
+	}
+
+	go func() {
+		defer w.asyncJobs.Done()
+
+		var errs []error
+		for _, name := range names {
+			archivePath, err := compressAndRemove(name, c, keep)
+			if err != nil {
+				atomic.AddUint64(&w.compressionErrors, 1)
+				errs = append(errs, err)
+			} else if err := a.replaceChecksum(name, archivePath); err != nil {
+				errs = append(errs, err)
+			}
+
+			if err := w.endCompression(name, archivePath, a); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		// the error callback may use the writer, like in compressAsync.
+		w.compressions.Done()
+
+		for _, err := range errs {
+			w.reportAsyncError(onError, err)
+		}
+	}()
+
+	return nil
+}
+
+// startCompression records that the rotated file at path is being compressed in
+// background, so that the retention counts it once with its compressed file and
+// doesn't remove it meanwhile.
+func (w *RotatingWriter) startCompression(path string) {
+	w.asyncLock.Lock()
+	defer w.asyncLock.Unlock()
+
+	if w.inflight == nil {
+		w.inflight = make(map[string]bool)
+	}
+	w.inflight[filepath.Clean(path)] = false
+}
+
+// compressing returns true if the rotated file at path is being compressed in background.
+func (w *RotatingWriter) compressing(path string) bool {
+	w.asyncLock.Lock()
+	defer w.asyncLock.Unlock()
+
+	_, ok := w.inflight[filepath.Clean(path)]
+
+	return ok
+}
+
+// removeAfterCompression returns true if the rotated file at path is being compressed
+// in background, in which case it is removed with its compressed file once compressed.
+func (w *RotatingWriter) removeAfterCompression(path string) bool {
+	w.asyncLock.Lock()
+	defer w.asyncLock.Unlock()
+
+	path = filepath.Clean(path)
+	if _, ok := w.inflight[path]; !ok {
+		return false
+	}
+	w.inflight[path] = true
+
+	return true
+}
+
+// endCompression records that the background compression of the rotated file at path
+// is done, archivePath being the resulting file, and removes it if the retention
+// asked for it meanwhile.
+func (w *RotatingWriter) endCompression(path, archivePath string, a archiver) error {
+	w.asyncLock.Lock()
+	remove := w.inflight[filepath.Clean(path)]
+	delete(w.inflight, filepath.Clean(path))
+	w.asyncLock.Unlock()
+
+	if !remove {
+		return nil
+	}
+
+	if err := removeArchive(archivePath, a.sidecars(archivePath), a.partitioned); err != nil {
+		return err
+	}
+	atomic.AddUint64(&w.retentionDeletions, 1)
+
+	return nil
+}
+
+// reportAsyncError reports an error happening in background to fn, if not nil,
+// and records it to be returned by Close.
+func (w *RotatingWriter) reportAsyncError(fn func(error), err error) {
+	if fn != nil {
+		fn(err)
+	}
+
+	w.asyncLock.Lock()
+	defer w.asyncLock.Unlock()
+
+	if w.asyncErr == nil {
+		w.asyncErr = err
+	}
+}
+
+// notifyRotate calls fn, if not nil, with the path of the rotated file.
+func notifyRotate(fn func(string, error), archivePath string, err error) {
+	if fn != nil {
+		fn(archivePath, err)
+	}
+}
+
+// archiver finishes the rotated files: it compresses them and writes their checksum
+// file. It holds a copy of the settings of the writer so that it can run in background.
+type archiver struct {
+	compress   bool
+	compressor Compressor
+	keep       bool
+	minSize    int64
+	checksum   crypto.Hash
+	dirSync    bool
+	errors     *uint64
+
+	// partitioned is used to remove the rotated file after its compression.
+	partitioned bool
+}
+
+// archiver returns an archiver using the current settings.
+func (w *RotatingWriter) archiver() archiver {
+	return archiver{
+		compress:   w.compress,
+		compressor: w.getCompressor(),
+		keep:       w.keepUncompressed,
+		minSize:    w.compressMinSize,
+		checksum:   w.checksum,
+		dirSync:    w.dirSync,
+		errors:     &w.compressionErrors,
+
+		partitioned: w.partitioned(),
+	}
+}
+
+// archive finishes the file at destName and returns the path of the rotated file.
+func (a archiver) archive(destName string) (string, error) {
+	archivePath := destName
+
+	if a.compress {
+		compress := true
+		if a.minSize > 0 {
+			fi, err := fsys.Stat(destName)
+			if err != nil {
+				return destName, err
+			}
+			compress = fi.Size() >= a.minSize
+		}
+
+		if compress {
+			var err error
+			if archivePath, err = compressAndRemove(destName, a.compressor, a.keep); err != nil {
+				atomic.AddUint64(a.errors, 1)
+				return archivePath, err
+			}
+		}
+	}
+
+	if err := writeChecksum(archivePath, a.checksum); err != nil {
+		return archivePath, err
+	}
+
+	// the files created since the rotation.
+	if a.dirSync && (archivePath != destName || a.checksum != 0) {
+		return archivePath, syncDir(filepath.Dir(archivePath))
+	}
+
+	return archivePath, nil
+}
+
+// replaceChecksum replaces the checksum file of the rotated file at name, compressed
+// to archivePath, by the one of archivePath, if a hash is set.
+func (a archiver) replaceChecksum(name, archivePath string) error {
+	if a.checksum == 0 {
+		return nil
+	}
+
+	if err := writeChecksum(archivePath, a.checksum); err != nil {
+		return err
+	}
+
+	if err := fsys.Remove(checksumPath(name, a.checksum)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// compressAndRemove compresses the file at destName and removes it, unless keep is true.
+//
+// It returns the path of the rotated file, which is the compressed one unless the
+// compression failed.
+func compressAndRemove(destName string, c Compressor, keep bool) (string, error) {
+	if err := compressFile(destName, c); err != nil {
+		return destName, err
+	}
+
+	if keep {
+		return destName + c.Extension(), nil
+	}
+
+	// no error to compress the data and to rename it
+	// to its last filename, we can now safely remove
+	// the original uncompressed file.
+	return destName + c.Extension(), fsys.Remove(destName)
+}
+
+// compressFile compresses the file at destName into a file at destName with the
+// extension of the compressor appended.
+func compressFile(destName string, c Compressor) (err error) {
+	var rotated, tmpFile *os.File
+
+	// open the rotated file.
+	if rotated, err = fsys.Open(destName); err != nil {
+		return err
+	}
+
+	defer rotated.Close()
+
+	// create a tmp file which will be the rotated one but compressed, in the same
+	// directory so that renaming it is atomic.
+	if tmpFile, err = fsys.TempFile(filepath.Dir(destName), tmpPrefix(destName)); err != nil {
+		return err
+	}
+
+	defer func() {
+		tmpFile.Close()
+
+		// don't leave a partially compressed file behind.
+		if err != nil {
+			fsys.Remove(tmpFile.Name())
+		}
+	}()
+
+	// compress
+	if err := c.Compress(tmpFile, rotated); err != nil {
+		return err
+	}
+
+	// keep the permissions of the rotated file.
+	fi, err := rotated.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := tmpFile.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	// force close just before renaming
+	rotated.Close()
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	// never replace nor append to a compressed file, whose data would be lost or
+	// wouldn't be readable by every decompressor.
+	if _, err := fsys.Stat(destName + c.Extension()); err == nil {
+		return ErrArchiveExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// rename the compressed file
+	if err := renameFile(tmpFile.Name(), destName+c.Extension()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// tmpPrefix returns the prefix of the name of the temporary files used to compress
+// the file at destName or to replace the file when rotating it to destName.
+func tmpPrefix(destName string) string {
+	return "." + filepath.Base(destName) + ".tmp"
+}
+
+// removeTempFiles removes the temporary files left by the compressions and the
+// rotations interrupted by a crash.
+func (w *RotatingWriter) removeTempFiles() error {
+	dirs, err := w.archiveDirs()
+	if err != nil {
+		return err
+	}
+
+	// the file is replaced using a temporary file next to it.
+	if dir := filepath.Dir(w.filename); !slices.Contains(dirs, dir) {
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		if err := w.removeDirTempFiles(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeDirTempFiles removes the temporary files in the directory dir.
+func (w *RotatingWriter) removeDirTempFiles(dir string) error {
+	infos, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range infos {
+		name := fi.Name()
+
+		i := strings.LastIndex(name, ".tmp")
+		if !strings.HasPrefix(name, ".") || i <= 0 {
+			continue
+		}
+
+		// only remove the temporary files of the rotated files of this writer.
+		if _, _, ok := w.parseDestName(name[1:i]); !ok {
+			continue
+		}
+
+		if w.dryRun != nil {
+			w.dryRun("remove " + filepath.Join(dir, name))
+			continue
+		}
+
+		if err := fsys.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nextDestName returns the name of the file to rotate to.
+func (w *RotatingWriter) nextDestName() (string, error) {
+	if w.sequential {
+		if err := w.shiftArchives(); err != nil {
+			return "", err
+		}
+
+		return w.archivePath() + ".1", nil
+	}
+
+	if w.nameFunc != nil {
+		return w.uniqueDestName(func(seq int) string {
+			return w.nameFunc(w.filename, w.startDate, seq)
+		})
+	}
+
+	if err := checkTimeFormatSeparator(w.getTimeFormat()); err != nil {
+		return "", err
+	}
+
+	name := w.makeDestName()
+
+	if w.seqDigits > 0 {
+		first, err := w.nextSeq()
+		if err != nil {
+			return "", err
+		}
+
+		return w.uniqueDestName(func(seq int) string {
+			s := strconv.Itoa(first + seq)
+			if len(s) < w.seqDigits {
+				s = strings.Repeat("0", w.seqDigits-len(s)) + s
+			}
+			return w.withSeq(name, s)
+		})
+	}
+
+	return w.uniqueDestName(func(seq int) string {
+		if seq == 0 {
+			return name
+		}
+		return w.withSeq(name, strconv.Itoa(seq))
+	})
+}
+
+// withSeq returns name, as returned by makeDestName, with the sequence number seq
+// appended, before the extension with Prefix: app.2006-01-02_1504.1.log.
+func (w *RotatingWriter) withSeq(name, seq string) string {
+	if w.prefix {
+		ext := prefixExt(w.filename)
+		return name[:len(name)-len(ext)] + "." + seq + ext
+	}
+
+	return name + "." + seq
+}
+
+// shiftArchives renames every rotated file named with a sequence number to the
+// next sequence number, making room for filename.1.
+func (w *RotatingWriter) shiftArchives() error {
+	// a pending compression would create its file using the old sequence number. The
+	// callbacks are not waited for, as they may use the writer.
+	w.compressions.Wait()
+
+	archives, err := w.listArchives()
+	if err != nil {
+		return err
+	}
+
+	// archives are sorted from the highest sequence number to the lowest.
+	base := filepath.Base(w.filename) + "."
+	for _, a := range archives {
+		dir, name := filepath.Split(a.path)
+		ext := name[len(base)+len(strconv.Itoa(a.seq)):]
+
+		newPath := filepath.Join(dir, base+strconv.Itoa(a.seq+1)+ext)
+		if w.dryRun != nil {
+			w.dryRun("rename " + a.path + " to " + newPath)
+			continue
+		}
+
+		if err := fsys.Rename(a.path, newPath); err != nil {
+			return err
+		}
+
+		newSidecars := w.sidecars(newPath)
+		for i, path := range w.sidecars(a.path) {
+			if err := fsys.Rename(path, newSidecars[i]); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// nextSeq returns the sequence number following the ones of the rotated files having
+// the same date as the file.
+func (w *RotatingWriter) nextSeq() (int, error) {
+	archives, err := w.listArchives()
+	if err != nil {
+		return 0, err
+	}
+
+	tf := w.getTimeFormat()
+	date := w.startDate.Format(tf)
+
+	last := 0
+	for _, a := range archives {
+		if a.date.Format(tf) == date && a.seq > last {
+			last = a.seq
+		}
+	}
+
+	return last + 1, nil
+}
+
+// uniqueDestName returns a name for the rotated file which doesn't overwrite an
+// existing rotated file, compressed or not.
+//
+// The name is generated by fn, which is called with the sequence numbers 0, 1, 2
+// and so on until the name is not already used.
+func (w *RotatingWriter) uniqueDestName(fn func(seq int) string) (string, error) {
+	for seq := 0; ; seq++ {
+		candidate := fn(seq)
+
+		exists, err := w.destExists(candidate)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			return candidate, nil
+		}
+	}
+}
+
+// destExists returns true if a rotated file named name exists, compressed or not.
+func (w *RotatingWriter) destExists(name string) (bool, error) {
+	names := []string{name}
+	if w.compress {
+		names = append(names, name+w.getCompressor().Extension())
+	}
+
+	for _, n := range names {
+		_, err := fsys.Stat(n)
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// wallClock is a time of day in a location.
+type wallClock struct {
+	hour   int
+	minute int
+	// loc is nil to use the location of the writer.
+	loc *time.Location
+}
+
+// next returns the first time strictly after t at which the wall clock in the location
+// shows the time of day.
+func (c wallClock) next(t time.Time) time.Time {
+	t = t.In(c.loc)
+
+	next := time.Date(t.Year(), t.Month(), t.Day(), c.hour, c.minute, 0, 0, c.loc)
+	if !next.After(t) {
+		// adding a day to the date instead of 24 hours handles the daylight saving time.
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, c.hour, c.minute, 0, 0, c.loc)
+	}
+
+	return next
+}
+
+// getSeparator returns the separator between the name of the file and the date.
+func (w *RotatingWriter) getSeparator() string {
+	if w.separator == "" {
+		return "."
+	}
+
+	return w.separator
+}
+
+// getTimeFormat returns the time format used for the rotated files.
+func (w *RotatingWriter) getTimeFormat() string {
+	if w.timeFormat != "" {
+		return w.timeFormat
+	}
+
+	return TimeFormat
+}
+
+// archivePath returns the path of the file, in the archive directory if one is set
+// and in the partition of the start date if the rotated files are partitioned.
+func (w *RotatingWriter) archivePath() string {
+	if w.partitioned() {
+		dir := filepath.Join(w.archiveRoot(), filepath.FromSlash(w.startDate.Format("2006/01/02")))
+		return filepath.Join(dir, filepath.Base(w.filename))
+	}
+
+	if w.archiveDir == "" {
+		return w.filename
+	}
+
+	return filepath.Join(w.archiveDir, filepath.Base(w.filename))
+}
+
+// archiveRoot returns the directory containing the rotated files or their partitions.
+func (w *RotatingWriter) archiveRoot() string {
+	if w.archiveDir == "" {
+		return filepath.Dir(w.filename)
+	}
+
+	return w.archiveDir
+}
+
+// partitioned returns true if the rotated files are partitioned by date.
+func (w *RotatingWriter) partitioned() bool {
+	return w.partitionByDate && !w.sequential && w.nameFunc == nil
+}
+
+func (w *RotatingWriter) makeDestName() string {
+	tf := w.getTimeFormat()
+	filename := w.archivePath()
+
+	if w.prefix {
+		ext := prefixExt(filename)
+		name := filename[:len(filename)-len(ext)]
+
+		return name + w.getSeparator() + w.startDate.Format(tf) + w.instance() + ext
+	}
+
+	return filename + w.getSeparator() + w.startDate.Format(tf) + w.instance()
+}
+
+// prefixExt returns the extension of the file, before which the date is put with
+// Prefix: the part of the base name starting at the last dot, except the leading dot
+// of a hidden file. It is empty if the file has no extension, the date is then put at
+// the end as without Prefix.
+func prefixExt(filename string) string {
+	ext := filepath.Ext(filename)
+	if ext == filepath.Base(filename) {
+		return ""
+	}
+
+	return ext
+}
+
+// instance returns the hostname and the process ID to put after the date in the
+// names of the rotated files, each with a leading dot, or an empty string.
+func (w *RotatingWriter) instance() string {
+	var s string
+	if w.hostname != "" {
+		s += "." + w.hostname
+	}
+	if w.pid != 0 {
+		s += "." + strconv.Itoa(w.pid)
 	}
 
-	return w.filename + "." + w.startDate.Format(tf)
+	return s
 }
@@ -1,7 +1,12 @@
 package logr
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -27,3 +32,196 @@ func TestMakeDestName(t *testing.T) {
 	expected = fmt.Sprintf("/var/log/logr.%s.log", now.Format(TimeFormat))
 	require.Equal(t, expected, n)
 }
+
+func TestCloseContextFileError(t *testing.T) {
+	w := newTestWriter(t)
+
+	// a pending compression.
+	w.asyncJobs.Add(1)
+	defer w.asyncJobs.Done()
+
+	require.Nil(t, w.file.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := w.CloseContext(ctx)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.True(t, errors.Is(err, os.ErrClosed))
+}
+
+func TestStatsDuringWrite(t *testing.T) {
+	w := newTestWriter(t)
+
+	_, err := w.WriteString("foo")
+	require.Nil(t, err)
+
+	// as if a write was in progress.
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	stats := make(chan Stats)
+	go func() { stats <- w.Stats() }()
+
+	select {
+	case s := <-stats:
+		require.Equal(t, uint64(3), s.BytesWritten)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stats waited for the lock")
+	}
+}
+
+func TestRotateHourly(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Hourly()
+
+	start := time.Now().Add(-time.Hour)
+	rw.startDate = start
+
+	_, err = rw.Write([]byte("foobar"))
+	require.Nil(t, err)
+
+	_, err = os.Stat(f.Name() + "." + start.Format(TimeFormat))
+	require.Nil(t, err)
+
+	// same hour, no rotation
+	require.Equal(t, time.Now().Truncate(time.Hour), rw.startDate.Truncate(time.Hour))
+	_, err = rw.Write([]byte("foobar"))
+	require.Nil(t, err)
+	require.Equal(t, int64(12), rw.currentSize)
+}
+
+func TestRotateEvery(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Every(15 * time.Minute)
+
+	start := time.Now().Add(-20 * time.Minute)
+	rw.startDate = start
+
+	_, err = rw.Write([]byte("foobar"))
+	require.Nil(t, err)
+
+	_, err = os.Stat(f.Name() + "." + start.Format(TimeFormat))
+	require.Nil(t, err)
+
+	// interval not elapsed, no rotation
+	_, err = rw.Write([]byte("foobar"))
+	require.Nil(t, err)
+	require.Equal(t, int64(12), rw.currentSize)
+}
+
+func TestRotateDailyAcrossMonth(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Daily()
+
+	// same day of month, but one month earlier
+	start := time.Now().AddDate(0, -1, 0)
+	rw.startDate = start
+
+	_, err = rw.Write([]byte("foobar"))
+	require.Nil(t, err)
+
+	_, err = os.Stat(f.Name() + "." + start.Format(TimeFormat))
+	require.Nil(t, err)
+	require.Equal(t, int64(6), rw.currentSize)
+}
+
+func TestWallClockNext(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.Nil(t, err)
+
+	c := wallClock{hour: 2, minute: 30, loc: paris}
+
+	testCases := []struct {
+		t        time.Time
+		expected time.Time
+	}{
+		{time.Date(2015, time.January, 1, 1, 0, 0, 0, paris), time.Date(2015, time.January, 1, 2, 30, 0, 0, paris)},
+		{time.Date(2015, time.January, 1, 2, 30, 0, 0, paris), time.Date(2015, time.January, 2, 2, 30, 0, 0, paris)},
+		{time.Date(2015, time.January, 31, 3, 0, 0, 0, paris), time.Date(2015, time.February, 1, 2, 30, 0, 0, paris)},
+		// 2:30 doesn't exist on the 29th of March 2015
+		{time.Date(2015, time.March, 28, 3, 0, 0, 0, paris), time.Date(2015, time.March, 29, 3, 30, 0, 0, paris)},
+		{time.Date(2015, time.March, 29, 3, 30, 0, 0, paris), time.Date(2015, time.March, 30, 2, 30, 0, 0, paris)},
+		// 2:30 occurs twice on the 25th of October 2015
+		{time.Date(2015, time.October, 24, 3, 0, 0, 0, paris), time.Date(2015, time.October, 25, 2, 30, 0, 0, paris)},
+		{time.Date(2015, time.October, 25, 2, 30, 0, 0, paris), time.Date(2015, time.October, 26, 2, 30, 0, 0, paris)},
+		// in another location
+		{time.Date(2015, time.January, 1, 3, 0, 0, 0, time.UTC), time.Date(2015, time.January, 2, 2, 30, 0, 0, paris)},
+	}
+
+	for _, tc := range testCases {
+		require.True(t, tc.expected.Equal(c.next(tc.t)), "%s: %s != %s", tc.t, tc.expected, c.next(tc.t))
+	}
+}
+
+// flagFS is a fileSystem recording the flags used to open the files.
+type flagFS struct {
+	osFS
+	flags *[]int
+}
+
+func (fs flagFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	*fs.flags = append(*fs.flags, flag)
+	return fs.osFS.OpenFile(name, flag, perm)
+}
+
+func TestSyncWrites(t *testing.T) {
+	w := newTestWriter(t)
+
+	var flags []int
+	defer withFS(flagFS{flags: &flags})()
+
+	w.SequentialNaming().SyncWrites()
+
+	_, err := w.WriteString("foo")
+	require.Nil(t, err)
+	require.Nil(t, w.Rotate())
+	require.Nil(t, w.Close())
+
+	require.Equal(t, 2, len(flags))
+	for _, flag := range flags {
+		require.Equal(t, os.O_SYNC, flag&os.O_SYNC)
+	}
+}
+
+// openFS is a fileSystem recording the names of the files opened for reading.
+type openFS struct {
+	osFS
+	names *[]string
+}
+
+func (fs openFS) Open(name string) (*os.File, error) {
+	*fs.names = append(*fs.names, name)
+	return fs.osFS.Open(name)
+}
+
+func TestDirSync(t *testing.T) {
+	w := newTestWriter(t)
+	archiveDir := filepath.Join(filepath.Dir(w.filename), "archive")
+
+	var names []string
+	defer withFS(openFS{names: &names})()
+
+	w.ArchiveDir(archiveDir).DirSync()
+	w.compress = true
+
+	_, err := w.WriteString("foo")
+	require.Nil(t, err)
+	require.Nil(t, w.Rotate())
+	require.Nil(t, w.Close())
+
+	destName := filepath.Join(archiveDir, "app.log.2015-01-01_0000")
+	require.Equal(t, []string{filepath.Dir(w.filename), archiveDir, destName, archiveDir}, names)
+}
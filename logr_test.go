@@ -3,7 +3,10 @@ package logr_test
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -178,3 +181,1713 @@ func TestRotateMaxSizePrefix(t *testing.T) {
 	rotatedData := readFile(t, name+"."+now.Format(logr.TimeFormat)+ext)
 	require.Nil(t, checkEqual(t, rotatedData, 0xFF))
 }
+
+func TestRotate(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+
+	now := time.Now()
+	{
+		n, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+		require.Equal(t, 1024, n)
+
+		require.Nil(t, rw.Rotate())
+
+		n, err = rw.Write(makeBuf(0xFE))
+		require.Nil(t, err)
+		require.Equal(t, 1024, n)
+	}
+
+	newData := readFile(t, f.Name())
+	require.Nil(t, checkEqual(t, newData, 0xFE))
+
+	rotatedData := readFile(t, f.Name()+"."+now.Format(logr.TimeFormat))
+	require.Nil(t, checkEqual(t, rotatedData, 0xFF))
+}
+
+func TestClose(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+
+	n, err := rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+	require.Equal(t, 1024, n)
+
+	require.Nil(t, rw.Sync())
+	require.Nil(t, rw.Close())
+	require.Nil(t, rw.Close())
+
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Equal(t, logr.ErrClosed, err)
+	require.Equal(t, logr.ErrClosed, rw.Rotate())
+	require.Equal(t, logr.ErrClosed, rw.Sync())
+
+	data := readFile(t, f.Name())
+	require.Nil(t, checkEqual(t, data, 0xFF))
+}
+
+func TestRotateDailyWithClock(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	now := time.Date(2015, time.January, 31, 23, 59, 0, 0, time.Local)
+	clock := func() time.Time { return now }
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(clock).Daily()
+
+	{
+		n, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+		require.Equal(t, 1024, n)
+
+		// cross midnight
+		now = now.Add(2 * time.Minute)
+
+		n, err = rw.Write(makeBuf(0xFE))
+		require.Nil(t, err)
+		require.Equal(t, 1024, n)
+	}
+
+	newData := readFile(t, f.Name())
+	require.Nil(t, checkEqual(t, newData, 0xFE))
+
+	rotatedData := readFile(t, f.Name()+".2015-01-31_2359")
+	require.Nil(t, checkEqual(t, rotatedData, 0xFF))
+}
+
+func TestCompressionLevel(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.CompressionLevel(gzip.BestCompression)
+
+	now := time.Now()
+	{
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	rotatedDataGz := readFile(t, f.Name()+"."+now.Format(logr.TimeFormat)+".gz")
+
+	r, err := gzip.NewReader(bytes.NewReader(rotatedDataGz))
+	require.Nil(t, err)
+
+	gunzip, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, checkEqual(t, gunzip, 0xFF))
+	require.Equal(t, 1024, len(gunzip))
+}
+
+func TestCompressionLevelInvalid(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+
+	defer func() {
+		require.NotNil(t, recover())
+	}()
+	rw.CompressionLevel(42)
+}
+
+func TestAsyncCompression(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).AsyncCompression(1)
+
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Hour)
+
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	require.Nil(t, rw.Close())
+
+	for _, suffix := range []string{".2015-01-01_0000", ".2015-01-01_0100", ".2015-01-01_0200"} {
+		_, err := os.Stat(f.Name() + suffix)
+		require.True(t, os.IsNotExist(err))
+
+		r, err := gzip.NewReader(bytes.NewReader(readFile(t, f.Name()+suffix+".gz")))
+		require.Nil(t, err)
+
+		gunzip, err := ioutil.ReadAll(r)
+		require.Nil(t, err)
+		require.Nil(t, checkEqual(t, gunzip, 0xFF))
+	}
+}
+
+func TestCloseContext(t *testing.T) {
+	f := tempLogFile(t)
+
+	release := make(chan struct{})
+	rotated := make(chan string, 1)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Compressor(blockingCompressor{release}).AsyncCompression(1).OnRotate(func(path string, err error) {
+		require.Nil(t, err)
+		rotated <- path
+	})
+
+	_, err = rw.WriteString("foobar")
+	require.Nil(t, err)
+	require.Nil(t, rw.Rotate())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, rw.CloseContext(ctx))
+
+	close(release)
+	require.Equal(t, []byte("foobar"), readFile(t, <-rotated))
+}
+
+func TestAsyncCompressionReconfigured(t *testing.T) {
+	f := tempLogFile(t)
+
+	release := make(chan struct{})
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Compressor(blockingCompressor{release}).AsyncCompression(1)
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+	require.Nil(t, rw.Rotate())
+
+	// while the compression is running.
+	rw.AsyncCompression(2)
+	close(release)
+
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Nil(t, rw.Rotate())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Nil(t, rw.CloseContext(ctx))
+}
+
+func TestSequentialAsyncCompressionCallback(t *testing.T) {
+	f := tempLogFile(t)
+
+	release := make(chan struct{})
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().Compressor(blockingCompressor{release}).AsyncCompression(1).OnRotate(func(path string, err error) {
+		require.Nil(t, err)
+		// the callback uses the writer while the next rotation waits for the compression.
+		rw.NextRotation()
+	})
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+	require.Nil(t, rw.Rotate())
+
+	done := make(chan error)
+	go func() {
+		_, err := rw.WriteString("bar")
+		require.Nil(t, err)
+		done <- rw.Rotate()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the rotation is blocked")
+	}
+	require.Nil(t, rw.Close())
+
+	require.Equal(t, []byte("foo"), readFile(t, f.Name()+".2.blk"))
+	require.Equal(t, []byte("bar"), readFile(t, f.Name()+".1.blk"))
+}
+
+// blockingCompressor copies the data once release is closed.
+type blockingCompressor struct {
+	release chan struct{}
+}
+
+func (c blockingCompressor) Extension() string { return ".blk" }
+
+func (c blockingCompressor) Compress(dst io.Writer, src io.Reader) error {
+	<-c.release
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+type upperCompressor struct{}
+
+func (c upperCompressor) Extension() string { return ".up" }
+
+func (c upperCompressor) Compress(dst io.Writer, src io.Reader) error {
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(bytes.ToUpper(data))
+	return err
+}
+
+func TestCustomCompressor(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Compressor(upperCompressor{})
+
+	now := time.Now()
+	{
+		_, err := rw.Write([]byte("foobar"))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	rotatedData := readFile(t, f.Name()+"."+now.Format(logr.TimeFormat)+".up")
+	require.Equal(t, []byte("FOOBAR"), rotatedData)
+}
+
+func TestCompressExtension(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).CompressExtension(".gzip").MaxBackups(1)
+
+	rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour))
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0100.gzip"}, names)
+}
+
+func TestKeepUncompressed(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).KeepUncompressed().MaxBackups(1)
+
+	rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour))
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0100", "app.log.2015-01-01_0100.gz"}, names)
+	require.Equal(t, makeBuf(0xFF), readFile(t, filepath.Join(dir, "app.log.2015-01-01_0100")))
+}
+
+func TestCompressMinSize(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).CompressMinSize(1024)
+
+	for _, s := range []string{"foo", string(makeBuf(0xFF))} {
+		now = now.Add(time.Hour)
+
+		_, err := rw.WriteString(s)
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0000", "app.log.2015-01-01_0100.gz"}, names)
+}
+
+func TestNewWriterWithCompressionError(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	// the parent "directory" is a regular file
+	rw, err := logr.NewWriterWithCompression(filepath.Join(f.Name(), "app.log"))
+	require.NotNil(t, err)
+	require.Nil(t, rw)
+}
+
+func TestNilFile(t *testing.T) {
+	_, err := logr.NewWriterFromFile(nil)
+	require.Equal(t, logr.ErrNilFile, err)
+
+	var rw logr.RotatingWriter
+
+	_, err = rw.Write([]byte("foo"))
+	require.Equal(t, logr.ErrNilFile, err)
+	_, err = rw.WriteString("foo")
+	require.Equal(t, logr.ErrNilFile, err)
+	require.Equal(t, logr.ErrNilFile, rw.Rotate())
+	require.Equal(t, logr.ErrNilFile, rw.Sync())
+	require.Equal(t, logr.ErrNilFile, rw.Close())
+}
+
+func TestFileInUse(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+
+	_, err = logr.NewWriter(f.Name())
+	require.Equal(t, logr.ErrInUse, err)
+
+	require.Nil(t, rw.Close())
+
+	rw, err = logr.NewWriter(f.Name())
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+}
+
+func TestNotRegular(t *testing.T) {
+	rw, err := logr.NewWriter(os.DevNull)
+	require.Nil(t, err)
+	rw.MaxSize(10)
+
+	for i := 0; i < 2; i++ {
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+	}
+
+	require.Equal(t, logr.ErrNotRegular, rw.Rotate())
+	require.Equal(t, uint64(0), rw.RotationCount())
+	require.Nil(t, rw.Close())
+}
+
+func TestNewWriterCreatesFile(t *testing.T) {
+	dir := t.TempDir()
+
+	filename := filepath.Join(dir, "myapp", "app.log")
+
+	rw, err := logr.NewWriter(filename)
+	require.Nil(t, err)
+
+	_, err = rw.Write([]byte("foobar"))
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+
+	require.Equal(t, []byte("foobar"), readFile(t, filename))
+}
+
+func TestRotatePreservesMode(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+	require.Nil(t, f.Chmod(0640))
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+
+	now := time.Now()
+	{
+		_, err := rw.Write([]byte("foobar"))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	fi, err := os.Stat(f.Name())
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	fi, err = os.Stat(f.Name() + "." + now.Format(logr.TimeFormat) + ".gz")
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+}
+
+func TestRotateNoOverwrite(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now })
+
+	for _, b := range []byte{0xFF, 0xFE, 0xFD} {
+		_, err := rw.Write(makeBuf(b))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	require.Nil(t, checkEqual(t, readFile(t, f.Name()+".2015-01-01_0000"), 0xFF))
+	require.Nil(t, checkEqual(t, readFile(t, f.Name()+".2015-01-01_0000.1"), 0xFE))
+	require.Nil(t, checkEqual(t, readFile(t, f.Name()+".2015-01-01_0000.2"), 0xFD))
+}
+
+func TestMaxOpenAge(t *testing.T) {
+	f := tempLogFile(t)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).MaxSize(1 << 20).MaxOpenAge(time.Hour)
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+
+	now = now.Add(59 * time.Minute)
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Equal(t, uint64(0), rw.RotationCount())
+
+	now = now.Add(time.Minute)
+	_, err = rw.WriteString("baz")
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), rw.RotationCount())
+	require.Equal(t, []byte("foobar"), readFile(t, f.Name()+".2015-01-01_0000"))
+}
+
+func TestRotateInBackground(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().DontRotateEmpty().Every(50 * time.Millisecond).RotateInBackground()
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+
+	for i := 0; i < 100 && rw.RotationCount() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the empty file is not rotated.
+	time.Sleep(100 * time.Millisecond)
+	require.Nil(t, rw.Close())
+
+	require.Equal(t, uint64(1), rw.RotationCount())
+	require.Equal(t, []byte("foo"), readFile(t, f.Name()+".1"))
+}
+
+func TestMinRotateInterval(t *testing.T) {
+	f := tempLogFile(t)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).MaxSize(1024).MinRotateInterval(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+	}
+	require.Equal(t, uint64(0), rw.RotationCount())
+	require.Equal(t, int64(3*1024), rw.CurrentSize())
+
+	now = now.Add(time.Minute)
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), rw.RotationCount())
+	require.Equal(t, 3*1024, len(readFile(t, f.Name()+".2015-01-01_0000")))
+}
+
+func TestRotateBeforeWrite(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.MaxSize(1500).RotateBeforeWrite()
+
+	now := time.Now()
+	{
+		n, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+		require.Equal(t, 1024, n)
+
+		// would exceed the maximum size
+		n, err = rw.Write(makeBuf(0xFE))
+		require.Nil(t, err)
+		require.Equal(t, 1024, n)
+	}
+
+	newData := readFile(t, f.Name())
+	require.Equal(t, 1024, len(newData))
+	require.Nil(t, checkEqual(t, newData, 0xFE))
+
+	rotatedData := readFile(t, f.Name()+"."+now.Format(logr.TimeFormat))
+	require.Equal(t, 1024, len(rotatedData))
+	require.Nil(t, checkEqual(t, rotatedData, 0xFF))
+}
+
+func TestSequentialNaming(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().MaxBackups(2)
+
+	for _, b := range []byte{0xFF, 0xFE, 0xFD} {
+		_, err := rw.Write(makeBuf(b))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	for i, b := range []byte{0xFD, 0xFE} {
+		r, err := gzip.NewReader(bytes.NewReader(readFile(t, fmt.Sprintf("%s.%d.gz", f.Name(), i+1))))
+		require.Nil(t, err)
+
+		gunzip, err := ioutil.ReadAll(r)
+		require.Nil(t, err)
+		require.Nil(t, checkEqual(t, gunzip, b))
+	}
+
+	_, err = os.Stat(f.Name() + ".3.gz")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestNameFunc(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := os.Create(filepath.Join(dir, "app.log"))
+	require.Nil(t, err)
+
+	now := time.Date(2015, time.January, 15, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).NameFunc(func(filename string, t time.Time, seq int) string {
+		return filepath.Join(filepath.Dir(filename), "archive", t.Format("2006/01"), fmt.Sprintf("app-%s-%d.log", t.Format("20060102"), seq))
+	})
+
+	for _, b := range []byte{0xFF, 0xFE} {
+		_, err := rw.Write(makeBuf(b))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	require.Nil(t, checkEqual(t, readFile(t, filepath.Join(dir, "archive", "2015", "01", "app-20150115-0.log")), 0xFF))
+	require.Nil(t, checkEqual(t, readFile(t, filepath.Join(dir, "archive", "2015", "01", "app-20150115-1.log")), 0xFE))
+}
+
+func TestArchiveDir(t *testing.T) {
+	f := tempLogFile(t)
+	archiveDir := filepath.Join(filepath.Dir(f.Name()), "archive")
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).ArchiveDir(archiveDir).MaxBackups(1)
+
+	for _, b := range []byte{0xFF, 0xFE} {
+		_, err := rw.Write(makeBuf(b))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+
+	require.Equal(t, []string{"app.log.2015-01-01_0000.1.gz"}, dirNames(t, archiveDir))
+
+	_, err = os.Stat(f.Name())
+	require.Nil(t, err)
+}
+
+func TestPartitionByDate(t *testing.T) {
+	f := tempLogFile(t)
+	archiveDir := filepath.Join(filepath.Dir(f.Name()), "archive")
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).ArchiveDir(archiveDir).PartitionByDate().MaxBackups(1)
+
+	rotateAt(t, rw, &now, now.AddDate(0, 0, 1), now.AddDate(0, 1, 1))
+
+	var paths []string
+	err = filepath.Walk(archiveDir, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			rel, _ := filepath.Rel(archiveDir, path)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"2015/01/02/app.log.2015-01-02_0000.gz"}, paths)
+
+	// the partition of the removed file is removed too.
+	_, err = os.Stat(filepath.Join(archiveDir, "2015", "01", "01"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestReopen(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	// rotated by an external tool
+	require.Nil(t, os.Rename(f.Name(), f.Name()+".1"))
+	require.Nil(t, rw.Reopen())
+
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Nil(t, err)
+
+	require.Nil(t, checkEqual(t, readFile(t, f.Name()+".1"), 0xFF))
+	require.Nil(t, checkEqual(t, readFile(t, f.Name()), 0xFE))
+	require.Equal(t, 1024, len(readFile(t, f.Name())))
+}
+
+func TestReopenExistingContent(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.MaxSize(2000)
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	// replaced by an external tool with a file having some content.
+	require.Nil(t, ioutil.WriteFile(f.Name()+".new", makeBuf(0xFE)[:1000], 0600))
+	require.Nil(t, os.Rename(f.Name()+".new", f.Name()))
+	require.Nil(t, rw.Reopen())
+	require.Equal(t, int64(1000), rw.CurrentSize())
+
+	_, err = rw.Write(makeBuf(0xFD))
+	require.Nil(t, err)
+	require.Equal(t, uint64(0), rw.RotationCount())
+
+	_, err = rw.Write(makeBuf(0xFD))
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), rw.RotationCount())
+}
+
+func TestResyncSize(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriter(f.Name())
+	require.Nil(t, err)
+	rw.Buffered(4096)
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+
+	// written by another process.
+	other, err := os.OpenFile(f.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	require.Nil(t, err)
+	_, err = other.WriteString("barbaz")
+	require.Nil(t, err)
+	require.Nil(t, other.Close())
+
+	require.Equal(t, int64(3), rw.CurrentSize())
+	require.Nil(t, rw.ResyncSize())
+	require.Equal(t, int64(9), rw.CurrentSize())
+
+	require.Nil(t, rw.Close())
+	require.Equal(t, logr.ErrClosed, rw.ResyncSize())
+}
+
+func TestKeepFileOpen(t *testing.T) {
+	f := tempLogFile(t)
+	defer f.Close()
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.KeepFileOpen().SequentialNaming()
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+	require.Nil(t, rw.Rotate())
+
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+
+	// the file provided is still open and now refers to the rotated file.
+	_, err = f.WriteString("baz")
+	require.Nil(t, err)
+
+	require.Equal(t, []byte("foobaz"), readFile(t, f.Name()+".1"))
+	require.Equal(t, []byte("bar"), readFile(t, f.Name()))
+}
+
+func TestReadSizeBeforeWrite(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriter(f.Name())
+	require.Nil(t, err)
+	rw.ReadSizeBeforeWrite().MaxSize(1024).Buffered(4096)
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+
+	// appended by another process.
+	other, err := os.OpenFile(f.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	require.Nil(t, err)
+	_, err = other.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+	require.Nil(t, other.Close())
+
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), rw.RotationCount())
+	require.Equal(t, int64(3), rw.CurrentSize())
+}
+
+func TestReopenOnChange(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.ReopenOnChange()
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+
+	// removed by mistake.
+	require.Nil(t, os.Remove(f.Name()))
+
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Equal(t, []byte("bar"), readFile(t, f.Name()))
+	require.Equal(t, int64(3), rw.CurrentSize())
+
+	// replaced by another file.
+	require.Nil(t, os.Rename(f.Name(), f.Name()+".old"))
+	require.Nil(t, ioutil.WriteFile(f.Name(), []byte("baz"), 0600))
+
+	_, err = rw.WriteString("qux")
+	require.Nil(t, err)
+	require.Equal(t, []byte("bazqux"), readFile(t, f.Name()))
+	require.Equal(t, []byte("bar"), readFile(t, f.Name()+".old"))
+}
+
+func TestRotateKeepsFileAvailable(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().MaxBackups(2)
+
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if _, err := os.Stat(f.Name()); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		_, err = rw.WriteString("foo")
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+	close(stop)
+
+	require.Nil(t, <-errs)
+	require.Nil(t, rw.Close())
+
+	// no temporary file is left.
+	require.Equal(t, []string{"app.log", "app.log.1", "app.log.2"}, dirNames(t, filepath.Dir(f.Name())))
+}
+
+func TestStdoutPassthrough(t *testing.T) {
+	f := tempLogFile(t)
+
+	stdout := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = stdout }()
+
+	rw, err := logr.NewWriter("-")
+	require.Nil(t, err)
+	rw.MaxSize(1).Daily()
+
+	// not in use by the first writer.
+	rw2, err := logr.NewWriter("/dev/stdout")
+	require.Nil(t, err)
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+	_, err = rw2.WriteString("bar")
+	require.Nil(t, err)
+	_, err = rw.WriteString("baz")
+	require.Nil(t, err)
+
+	require.Nil(t, rw.Rotate())
+	require.Nil(t, rw.Reopen())
+	require.Nil(t, rw.Close())
+	require.Nil(t, rw2.Close())
+
+	// still open.
+	_, err = f.WriteString("qux")
+	require.Nil(t, err)
+
+	require.Equal(t, []byte("foobarbazqux"), readFile(t, f.Name()))
+
+	require.Len(t, dirNames(t, filepath.Dir(f.Name())), 1)
+}
+
+func TestWriteLine(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.MaxLines(2)
+
+	b := make([]byte, 3, 10)
+	copy(b, "foo")
+
+	n, err := rw.WriteLine(b)
+	require.Nil(t, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, []byte("foo"), b[:cap(b)][:3])
+	require.Equal(t, byte(0), b[:cap(b)][3])
+
+	n, err = rw.WriteLine([]byte("bar\n"))
+	require.Nil(t, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, int64(8), rw.CurrentSize())
+	require.Equal(t, []byte("foo\nbar\n"), readFile(t, f.Name()))
+
+	// rotated after two lines.
+	n, err = rw.WriteLine(nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, uint64(1), rw.RotationCount())
+	require.Equal(t, int64(1), rw.CurrentSize())
+	require.Equal(t, []byte("\n"), readFile(t, f.Name()))
+}
+
+func TestCopyTruncate(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.CopyTruncate()
+
+	fi1, err := os.Stat(f.Name())
+	require.Nil(t, err)
+
+	now := time.Now()
+	{
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+
+		_, err = rw.Write(makeBuf(0xFE))
+		require.Nil(t, err)
+	}
+
+	// still the same file
+	fi2, err := os.Stat(f.Name())
+	require.Nil(t, err)
+	require.True(t, os.SameFile(fi1, fi2))
+
+	newData := readFile(t, f.Name())
+	require.Equal(t, 1024, len(newData))
+	require.Nil(t, checkEqual(t, newData, 0xFE))
+
+	r, err := gzip.NewReader(bytes.NewReader(readFile(t, f.Name()+"."+now.Format(logr.TimeFormat)+".gz")))
+	require.Nil(t, err)
+
+	gunzip, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, 1024, len(gunzip))
+	require.Nil(t, checkEqual(t, gunzip, 0xFF))
+}
+
+func TestBuffered(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Buffered(4096).MaxSize(1500)
+
+	now := time.Now()
+	{
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+		_, err = rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+
+		// still in the buffer
+		require.Equal(t, 0, len(readFile(t, f.Name())))
+
+		// rotates as the buffered bytes count
+		_, err = rw.Write(makeBuf(0xFE))
+		require.Nil(t, err)
+	}
+
+	rotatedData := readFile(t, f.Name()+"."+now.Format(logr.TimeFormat))
+	require.Equal(t, 2048, len(rotatedData))
+	require.Nil(t, checkEqual(t, rotatedData, 0xFF))
+
+	require.Equal(t, 0, len(readFile(t, f.Name())))
+	require.Nil(t, rw.Sync())
+
+	newData := readFile(t, f.Name())
+	require.Equal(t, 1024, len(newData))
+	require.Nil(t, checkEqual(t, newData, 0xFE))
+}
+
+func TestFlush(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	require.Nil(t, rw.Flush())
+	rw.Buffered(4096).SequentialNaming()
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(readFile(t, f.Name())))
+
+	require.Nil(t, rw.Flush())
+	require.Equal(t, []byte("foo"), readFile(t, f.Name()))
+
+	// the buffered data is written before rotating.
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Nil(t, rw.Rotate())
+
+	_, err = rw.WriteString("baz")
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+
+	require.Equal(t, []byte("foobar"), readFile(t, f.Name()+".1"))
+	require.Equal(t, []byte("baz"), readFile(t, f.Name()))
+	require.Equal(t, logr.ErrClosed, rw.Flush())
+}
+
+func TestFilename(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	require.Equal(t, f.Name(), rw.Filename())
+
+	require.Nil(t, rw.Rotate())
+	require.Equal(t, f.Name(), rw.Filename())
+}
+
+func TestFile(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	require.Equal(t, f, rw.File())
+
+	require.Nil(t, rw.Rotate())
+	require.NotEqual(t, f, rw.File())
+	require.Equal(t, f.Name(), rw.File().Name())
+}
+
+func TestCurrentSizeAndRotationCount(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.SequentialNaming()
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+	require.Equal(t, int64(1024), rw.CurrentSize())
+	require.Equal(t, uint64(0), rw.RotationCount())
+
+	require.Nil(t, rw.Rotate())
+	require.Nil(t, rw.Rotate())
+	require.Equal(t, int64(0), rw.CurrentSize())
+	require.Equal(t, uint64(2), rw.RotationCount())
+}
+
+func TestNextRotation(t *testing.T) {
+	f := tempLogFile(t)
+
+	now := time.Date(2015, time.January, 1, 10, 30, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now })
+
+	require.True(t, rw.NextRotation().IsZero())
+
+	rw.Daily()
+	require.Equal(t, time.Date(2015, time.January, 2, 0, 0, 0, 0, time.Local), rw.NextRotation())
+
+	rw.Every(10 * time.Minute)
+	require.Equal(t, time.Date(2015, time.January, 1, 10, 40, 0, 0, time.Local), rw.NextRotation())
+
+	now = now.Add(15 * time.Minute)
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2015, time.January, 1, 10, 55, 0, 0, time.Local), rw.NextRotation())
+}
+
+func TestStartDateFromModTime(t *testing.T) {
+	f := tempLogFile(t)
+
+	// written by a previous process.
+	_, err := f.WriteString("foo")
+	require.Nil(t, err)
+	modTime := time.Now().Add(-20 * time.Hour).Truncate(time.Second)
+	require.Nil(t, os.Chtimes(f.Name(), modTime, modTime))
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Every(24 * time.Hour)
+	require.True(t, rw.NextRotation().Equal(modTime.Add(24*time.Hour)))
+
+	// setting a clock keeps the modification time.
+	rw.Clock(time.Now)
+	require.True(t, rw.NextRotation().Equal(modTime.Add(24*time.Hour)))
+
+	start := time.Now().Add(-30 * time.Hour)
+	rw.StartDate(start)
+	require.True(t, rw.NextRotation().Equal(start.Add(24*time.Hour)))
+
+	// overdue.
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), rw.RotationCount())
+	require.Nil(t, rw.Close())
+
+	// an empty file starts now.
+	f = tempLogFile(t)
+	require.Nil(t, os.Chtimes(f.Name(), modTime, modTime))
+
+	rw, err = logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Every(24 * time.Hour)
+	require.True(t, rw.NextRotation().After(time.Now().Add(23*time.Hour)))
+}
+
+func TestRotateHourlyHalfHourOffset(t *testing.T) {
+	f := tempLogFile(t)
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	defer rw.Close()
+	rw.Hourly().StartDate(time.Date(2015, time.January, 1, 10, 20, 0, 0, kolkata))
+
+	require.True(t, rw.NextRotation().Equal(time.Date(2015, time.January, 1, 11, 0, 0, 0, kolkata)))
+}
+
+func TestUTC(t *testing.T) {
+	f := tempLogFile(t)
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.Nil(t, err)
+
+	// 2015-01-01 00:30 in Paris is 2014-12-31 23:30 UTC.
+	now := time.Date(2015, time.January, 1, 0, 30, 0, 0, paris)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).UTC().Daily()
+
+	require.Equal(t, time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC), rw.NextRotation())
+
+	rw.DailyAt(6, 0, nil)
+	require.Equal(t, time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC), rw.NextRotation())
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+
+	// rotated as the UTC day changes.
+	now = now.Add(time.Hour)
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+
+	require.Equal(t, []byte("foo"), readFile(t, f.Name()+".2014-12-31_2330"))
+	require.Equal(t, time.Date(2015, time.January, 1, 6, 0, 0, 0, time.UTC), rw.NextRotation())
+}
+
+func TestOnRotate(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	var archives []string
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().OnRotate(func(archivePath string, err error) {
+		require.Nil(t, err)
+		archives = append(archives, archivePath)
+	})
+
+	require.Nil(t, rw.Rotate())
+	require.Nil(t, rw.Rotate())
+
+	require.Equal(t, []string{f.Name() + ".1.gz", f.Name() + ".1.gz"}, archives)
+}
+
+func TestOnError(t *testing.T) {
+	f := tempLogFile(t)
+
+	var errs []error
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.MaxSize(512).OnError(func(err error) {
+		errs = append(errs, err)
+	})
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	// make the rotation fail
+	require.Nil(t, os.RemoveAll(filepath.Dir(f.Name())))
+
+	// the data is still written, to the file which was removed.
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Nil(t, err)
+	require.Len(t, errs, 1)
+	require.NotNil(t, errs[0])
+}
+
+func TestSymlink(t *testing.T) {
+	f := tempLogFile(t)
+	link := filepath.Join(filepath.Dir(f.Name()), "app.log.current")
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Symlink(link)
+
+	target, err := os.Readlink(link)
+	require.Nil(t, err)
+	require.Equal(t, f.Name(), target)
+
+	require.Nil(t, os.Remove(link))
+	require.Nil(t, rw.Rotate())
+
+	_, err = rw.Write([]byte("foobar"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("foobar"), readFile(t, link))
+}
+
+func TestWriteString(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.MaxSize(4)
+
+	now := time.Now()
+	{
+		n, err := io.WriteString(rw, "foobar")
+		require.Nil(t, err)
+		require.Equal(t, 6, n)
+
+		n, err = rw.WriteString("barbaz")
+		require.Nil(t, err)
+		require.Equal(t, 6, n)
+	}
+
+	require.Equal(t, []byte("barbaz"), readFile(t, f.Name()))
+	require.Equal(t, []byte("foobar"), readFile(t, f.Name()+"."+now.Format(logr.TimeFormat)))
+}
+
+func TestDontRotateEmpty(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).Daily().DontRotateEmpty()
+
+	// a quiet day
+	now = now.AddDate(0, 0, 1)
+	require.Nil(t, rw.Rotate())
+	require.Equal(t, uint64(0), rw.RotationCount())
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	now = now.AddDate(0, 0, 1)
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), rw.RotationCount())
+
+	require.Nil(t, checkEqual(t, readFile(t, f.Name()+".2015-01-02_0000"), 0xFF))
+	_, err = os.Stat(f.Name() + ".2015-01-01_0000")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRotateOnOpen(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	// content of a previous run
+	_, err = f.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	mtime := time.Date(2015, time.January, 1, 12, 30, 0, 0, time.Local)
+	require.Nil(t, os.Chtimes(f.Name(), mtime, mtime))
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.RotateOnOpen()
+
+	for _, b := range []byte{0xFE, 0xFD} {
+		_, err := rw.Write(makeBuf(b))
+		require.Nil(t, err)
+	}
+	require.Equal(t, uint64(1), rw.RotationCount())
+
+	require.Nil(t, checkEqual(t, readFile(t, f.Name()+".2015-01-01_1230"), 0xFF))
+
+	newData := readFile(t, f.Name())
+	require.Equal(t, 2048, len(newData))
+	require.Nil(t, checkEqual(t, newData[:1024], 0xFE))
+}
+
+func TestMaxLines(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.MaxLines(2)
+
+	now := time.Now()
+	{
+		_, err := rw.Write([]byte("foo\nbar"))
+		require.Nil(t, err)
+		_, err = rw.WriteString("baz\n")
+		require.Nil(t, err)
+
+		_, err = rw.Write([]byte("qux\n"))
+		require.Nil(t, err)
+	}
+
+	require.Equal(t, []byte("qux\n"), readFile(t, f.Name()))
+	require.Equal(t, []byte("foo\nbarbaz\n"), readFile(t, f.Name()+"."+now.Format(logr.TimeFormat)))
+}
+
+func TestCompressExisting(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	// left uncompressed by a previous run
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app.log.2015-01-01_0000"), makeBuf(0xFF), 0600))
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.CompressExisting()
+
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0000.gz"}, names)
+
+	r, err := gzip.NewReader(bytes.NewReader(readFile(t, filepath.Join(dir, "app.log.2015-01-01_0000.gz"))))
+	require.Nil(t, err)
+
+	gunzip, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, checkEqual(t, gunzip, 0xFF))
+}
+
+func TestCompressExistingDoesNotOverwrite(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	// the same rotated file, compressed and uncompressed.
+	archive := filepath.Join(dir, "app.log.2015-01-01_0000")
+	require.Nil(t, ioutil.WriteFile(archive, makeBuf(0xFF), 0600))
+	require.Nil(t, ioutil.WriteFile(archive+".gz", []byte("foo"), 0600))
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.CompressExisting()
+
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Nil(t, err)
+	require.True(t, errors.Is(rw.Close(), logr.ErrArchiveExists))
+
+	require.Nil(t, checkEqual(t, readFile(t, archive), 0xFF))
+	require.Equal(t, []byte("foo"), readFile(t, archive+".gz"))
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	// left by a crash during a compression, and unrelated files
+	for _, name := range []string{".app.log.2015-01-01_0000.tmp123456", ".other.log.2015-01-01_0000.tmp123456", "tmp123456"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{".other.log.2015-01-01_0000.tmp123456", "app.log", "tmp123456"}, names)
+}
+
+type failingCompressor struct{}
+
+func (c failingCompressor) Extension() string { return ".fail" }
+
+func (c failingCompressor) Compress(dst io.Writer, src io.Reader) error {
+	if _, err := io.CopyN(dst, src, 10); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("compression failed")
+}
+
+func TestCompressionFailureRemovesTempFile(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).Compressor(failingCompressor{})
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+	require.NotNil(t, rw.Rotate())
+
+	names := dirNames(t, dir)
+
+	// the rotated file is kept uncompressed
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0000"}, names)
+	require.Nil(t, checkEqual(t, readFile(t, filepath.Join(dir, "app.log.2015-01-01_0000")), 0xFF))
+}
+
+func TestRotateFailureKeepsWriting(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	// the rename fails as the file doesn't exist anymore
+	require.Nil(t, os.Remove(f.Name()))
+	require.NotNil(t, rw.Rotate())
+
+	_, err = rw.Write(makeBuf(0xFE))
+	require.Nil(t, err)
+	require.Equal(t, int64(1024), rw.CurrentSize())
+
+	newData := readFile(t, f.Name())
+	require.Equal(t, 1024, len(newData))
+	require.Nil(t, checkEqual(t, newData, 0xFE))
+}
+
+func TestReadFrom(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().MaxSize(40 * 1024)
+
+	data := bytes.Repeat([]byte{0xFF}, 100*1024)
+
+	// hide the WriterTo implementation of bytes.Reader
+	n, err := io.Copy(rw, struct{ io.Reader }{bytes.NewReader(data)})
+	require.Nil(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, uint64(1), rw.RotationCount())
+
+	rotatedData := readFile(t, f.Name()+".1")
+	require.Equal(t, 64*1024, len(rotatedData))
+
+	newData := readFile(t, f.Name())
+	require.Equal(t, 36*1024, len(newData))
+}
+
+// chunkReader returns its chunks one per Read.
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.chunks[0])
+	r.chunks[0] = r.chunks[0][n:]
+	if len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+	}
+
+	return n, nil
+}
+
+func TestReadFromKeepsLines(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().MaxLines(2).LineTransform(func(line []byte) []byte {
+		return append([]byte("> "), line...)
+	})
+
+	// the second line spans two chunks, the last one has no newline.
+	n, err := rw.ReadFrom(&chunkReader{chunks: []string{"foo\nba", "r\nbaz\n", "qux"}})
+	require.Nil(t, err)
+	require.Equal(t, int64(15), n)
+	require.Equal(t, uint64(1), rw.RotationCount())
+
+	require.Equal(t, []byte("> foo\n> bar\n> baz\n"), readFile(t, f.Name()+".1"))
+	require.Equal(t, []byte("> qux"), readFile(t, f.Name()))
+}
+
+func BenchmarkWriteWithConcurrentReads(b *testing.B) {
+	f, err := ioutil.TempFile(b.TempDir(), "logr")
+	require.Nil(b, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(b, err)
+	rw.Buffered(64 * 1024)
+	defer rw.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					rw.CurrentSize()
+					rw.RotationCount()
+				}
+			}
+		}()
+	}
+
+	buf := []byte("foobar\n")
+
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := rw.Write(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.SequentialNaming().Header([]byte("a,b\n")).MaxSize(12).RotateBeforeWrite()
+
+	for _, s := range []string{"1,2\n", "3,4\n", "5,6\n"} {
+		_, err := rw.WriteString(s)
+		require.Nil(t, err)
+	}
+
+	require.Equal(t, []byte("a,b\n1,2\n3,4\n"), readFile(t, f.Name()+".1"))
+	require.Equal(t, []byte("a,b\n5,6\n"), readFile(t, f.Name()))
+	require.Equal(t, int64(8), rw.CurrentSize())
+}
+
+func TestLineTransform(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.LineTransform(bytes.ToUpper)
+
+	n, err := rw.WriteString("foo\nbar\n")
+	require.Nil(t, err)
+	require.Equal(t, 8, n)
+
+	rw.LineTransform(func(line []byte) []byte { return append([]byte("> "), line...) })
+
+	n, err = rw.Write([]byte("baz\nqux"))
+	require.Nil(t, err)
+	require.Equal(t, 7, n)
+
+	require.Equal(t, int64(19), rw.CurrentSize())
+	require.Equal(t, []byte("FOO\nBAR\n> baz\n> qux"), readFile(t, f.Name()))
+}
+
+func TestTimestampTransform(t *testing.T) {
+	f := tempLogFile(t)
+
+	now := time.Date(2015, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).UTC()
+	rw.LineTransform(rw.TimestampTransform(time.RFC3339))
+
+	_, err = rw.WriteString("foo\nbar\n")
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+
+	require.Equal(t, "2015-01-01T10:00:00Z foo\n2015-01-01T10:00:00Z bar\n", string(readFile(t, f.Name())))
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestTee(t *testing.T) {
+	f := tempLogFile(t)
+
+	var errs []error
+	var buf bytes.Buffer
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Tee(&buf).Header([]byte("header\n")).OnError(func(err error) {
+		errs = append(errs, err)
+	})
+
+	_, err = rw.WriteString("foo\n")
+	require.Nil(t, err)
+	_, err = rw.Write([]byte("bar\n"))
+	require.Nil(t, err)
+	require.Equal(t, "foo\nbar\n", buf.String())
+
+	rw.Tee(failingWriter{})
+	_, err = rw.WriteString("baz\n")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(errs))
+
+	require.Equal(t, []byte("header\nfoo\nbar\nbaz\n"), readFile(t, f.Name()))
+}
+
+func TestDiskFull(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+
+	var buf bytes.Buffer
+
+	rw, err := logr.NewWriter("/dev/full")
+	require.Nil(t, err)
+	rw.FreeSpaceOnDiskFull().FallbackWriter(&buf)
+
+	n, err := rw.WriteString("foo")
+	require.Equal(t, logr.ErrDiskFull, err)
+	require.Equal(t, 0, n)
+
+	_, err = rw.Write([]byte("bar"))
+	require.Equal(t, logr.ErrDiskFull, err)
+
+	require.Equal(t, "foobar", buf.String())
+	require.Nil(t, rw.Close())
+}
+
+func TestWriteTo(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriter(f.Name())
+	require.Nil(t, err)
+	rw.Buffered(4096)
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	n, err := rw.WriteTo(&buf)
+	require.Nil(t, err)
+	require.Equal(t, int64(3), n)
+	require.Equal(t, "foo", buf.String())
+
+	// the next writes still append.
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+	require.Equal(t, []byte("foobar"), readFile(t, f.Name()))
+}
+
+func TestRateLimit(t *testing.T) {
+	f := tempLogFile(t)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).RateLimit(1024, true)
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	n, err := rw.WriteString("foo")
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+
+	now = now.Add(time.Second)
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+
+	require.Equal(t, uint64(3), rw.Stats().DroppedBytes)
+	require.Equal(t, append(makeBuf(0xFF), "bar"...), readFile(t, f.Name()))
+}
+
+func TestFallbackWriter(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	var fallback bytes.Buffer
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.FallbackWriter(&fallback)
+
+	_, err = rw.Write([]byte("foo"))
+	require.Nil(t, err)
+
+	// make the write fail
+	require.Nil(t, f.Close())
+
+	_, err = rw.Write([]byte("bar"))
+	require.NotNil(t, err)
+
+	require.Equal(t, []byte("foo"), readFile(t, f.Name()))
+	require.Equal(t, "bar", fallback.String())
+}
@@ -0,0 +1,86 @@
+package logr
+
+import "time"
+
+// Option configures a RotatingWriter, see NewWriterWithOptions and Reconfigure.
+type Option func(w *RotatingWriter)
+
+// NewWriterWithOptions creates a new file like NewWriter and returns a rotating
+// writer configured with the options.
+func NewWriterWithOptions(filename string, opts ...Option) (*RotatingWriter, error) {
+	w, err := NewWriter(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Reconfigure(opts...)
+
+	return w, nil
+}
+
+// Reconfigure atomically applies the options to the writer: no write happens while
+// only some of them are applied.
+//
+// The options take effect at the next write. As the time of the next time-based
+// rotation is computed from the creation of the current file, changing the interval
+// can trigger a rotation at the next write. Changing the naming of the rotated files,
+// for example with WithTimeFormat, makes MaxBackups and MaxAge ignore the files
+// rotated with the previous naming.
+func (w *RotatingWriter) Reconfigure(opts ...Option) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, opt := range opts {
+		opt(w)
+	}
+}
+
+// WithDaily is the option equivalent of Daily.
+func WithDaily() Option {
+	return func(w *RotatingWriter) { w.daily = true }
+}
+
+// WithHourly is the option equivalent of Hourly.
+func WithHourly() Option {
+	return func(w *RotatingWriter) { w.hourly = true }
+}
+
+// WithEvery is the option equivalent of Every.
+func WithEvery(d time.Duration) Option {
+	return func(w *RotatingWriter) { w.interval = d }
+}
+
+// WithMaxSize is the option equivalent of MaxSize.
+func WithMaxSize(s int64) Option {
+	return func(w *RotatingWriter) { w.maxSize = s }
+}
+
+// WithCompression enables the compression of the rotated files with gzip.
+func WithCompression() Option {
+	return func(w *RotatingWriter) { w.compress = true }
+}
+
+// WithTimeFormat is the option equivalent of TimeFormat.
+func WithTimeFormat(s string) Option {
+	return func(w *RotatingWriter) { w.timeFormat = s }
+}
+
+// WithPrefix is the option equivalent of Prefix.
+func WithPrefix() Option {
+	return func(w *RotatingWriter) { w.prefix = true }
+}
+
+// WithRotateOnOpen is the option equivalent of RotateOnOpen.
+func WithRotateOnOpen() Option {
+	return func(w *RotatingWriter) { w.rotateOnOpen = true }
+}
+
+// WithMaxBackups is the option equivalent of MaxBackups.
+func WithMaxBackups(n int) Option {
+	return func(w *RotatingWriter) { w.maxBackups = n }
+}
+
+// WithMaxAge is the option equivalent of MaxAge.
+func WithMaxAge(d time.Duration) Option {
+	return func(w *RotatingWriter) { w.maxAge = d }
+}
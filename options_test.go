@@ -0,0 +1,71 @@
+package logr_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vrischmann/logr"
+)
+
+func TestNewWriterWithOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	filename := filepath.Join(dir, "app.log")
+
+	rw, err := logr.NewWriterWithOptions(filename,
+		logr.WithMaxSize(512),
+		logr.WithCompression(),
+		logr.WithTimeFormat("2006__01__02"),
+		logr.WithPrefix(),
+	)
+	require.Nil(t, err)
+
+	now := time.Now()
+	{
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+
+		_, err = rw.Write(makeBuf(0xFE))
+		require.Nil(t, err)
+	}
+
+	newData := readFile(t, filename)
+	require.Nil(t, checkEqual(t, newData, 0xFE))
+
+	r, err := gzip.NewReader(bytes.NewReader(readFile(t, filepath.Join(dir, "app."+now.Format("2006__01__02")+".log.gz"))))
+	require.Nil(t, err)
+
+	gunzip, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Nil(t, checkEqual(t, gunzip, 0xFF))
+}
+
+func TestReconfigure(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+
+	now := time.Now()
+	{
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+
+		rw.Reconfigure(logr.WithMaxSize(512), logr.WithTimeFormat("2006__01__02"))
+
+		_, err = rw.Write(makeBuf(0xFE))
+		require.Nil(t, err)
+	}
+
+	newData := readFile(t, f.Name())
+	require.Nil(t, checkEqual(t, newData, 0xFE))
+
+	rotatedData := readFile(t, f.Name()+"."+now.Format("2006__01__02"))
+	require.Nil(t, checkEqual(t, rotatedData, 0xFF))
+}
@@ -0,0 +1,102 @@
+package logr
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// tokenBucket limits a rate of bytes per second, allowing bursts of one second.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// take takes n tokens at now, and returns how long to wait for them to be available.
+// If drop is true, the tokens are only taken if they are available, and the returned
+// duration is not zero if they are not.
+func (b *tokenBucket) take(n int, now time.Time, drop bool) time.Duration {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+
+	// a write larger than a burst only needs a full bucket, the tokens it lacks are
+	// owed by the next writes.
+	missing := math.Min(float64(n), b.rate) - b.tokens
+	if missing > 0 && drop {
+		return time.Duration(missing / b.rate * float64(time.Second))
+	}
+
+	b.tokens -= float64(n)
+	if missing <= 0 {
+		return 0
+	}
+
+	return time.Duration(missing / b.rate * float64(time.Second))
+}
+
+// RateLimit limits the writes to bytesPerSecond bytes per second, allowing bursts of one
+// second, to protect the disk during a flood of logs.
+//
+// Beyond the limit, the writes block if drop is false, according to the clock of the
+// writer, without blocking the rotations. If drop is true the data is dropped instead,
+// and the write returns its length and no error as if it was written; the dropped
+// bytes are counted in the Stats. A write larger than bytesPerSecond passes once the
+// limit allows a full burst, the next writes then wait or are dropped until it is
+// paid off. A value of 0 or less removes the limit.
+func (w *RotatingWriter) RateLimit(bytesPerSecond int, drop bool) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.limiter = nil
+	if bytesPerSecond > 0 {
+		w.limiter = &tokenBucket{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond)}
+	}
+	w.dropOverLimit = drop
+
+	return w
+}
+
+// rateLimitPoll is the maximum time slept before checking the clock of the writer
+// again while waiting for the rate limit, so that a clock set by Clock is followed.
+const rateLimitPoll = 10 * time.Millisecond
+
+// limit waits until n bytes can be written according to the rate limit, and returns
+// false if they must be dropped instead. It must be called without holding the file
+// lock, which is not held while waiting.
+func (w *RotatingWriter) limit(n int) bool {
+	w.lock.Lock()
+
+	if w.limiter == nil || w.checkOpen() != nil {
+		w.lock.Unlock()
+		return true
+	}
+
+	now := w.currentTime()
+	wait := w.limiter.take(n, now, w.dropOverLimit)
+	drop := w.dropOverLimit
+	clock := w.now
+
+	w.lock.Unlock()
+
+	if wait > 0 && drop {
+		atomic.AddUint64(&w.droppedBytes, uint64(n))
+		return false
+	}
+
+	for deadline := now.Add(wait); ; {
+		left := deadline.Sub(clock())
+		if left <= 0 {
+			return true
+		}
+		if left > rateLimitPoll {
+			left = rateLimitPoll
+		}
+		time.Sleep(left)
+	}
+}
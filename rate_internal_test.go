@@ -0,0 +1,77 @@
+package logr
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	b := &tokenBucket{rate: 100, tokens: 100}
+	require.Equal(t, time.Duration(0), b.take(100, now, false))
+	require.Equal(t, 500*time.Millisecond, b.take(50, now, false))
+
+	// the tokens owed are refilled first.
+	now = now.Add(time.Second)
+	require.Equal(t, time.Duration(0), b.take(50, now, false))
+
+	// the bursts are limited to one second.
+	now = now.Add(time.Hour)
+	require.Equal(t, time.Duration(0), b.take(100, now, true))
+	require.Equal(t, 10*time.Millisecond, b.take(1, now, true))
+
+	// nothing is taken when dropping.
+	now = now.Add(time.Second)
+	require.Equal(t, time.Duration(0), b.take(100, now, true))
+
+	// a write larger than a burst passes with a full bucket, the next ones pay for it.
+	now = now.Add(time.Second)
+	require.Equal(t, time.Duration(0), b.take(150, now, true))
+	require.Equal(t, 510*time.Millisecond, b.take(1, now, true))
+}
+
+func TestRateLimitClock(t *testing.T) {
+	w := newTestWriter(t)
+
+	var lock sync.Mutex
+	now := w.now()
+	w.Clock(func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}).RateLimit(100, false)
+
+	_, err := w.Write(make([]byte, 100))
+	require.Nil(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := w.Write(make([]byte, 50))
+		done <- err
+	}()
+
+	// the write waits for the clock, without holding the lock.
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("the write didn't wait")
+	default:
+	}
+	require.Equal(t, int64(100), w.CurrentSize())
+
+	lock.Lock()
+	now = now.Add(500 * time.Millisecond)
+	lock.Unlock()
+
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the write is still waiting")
+	}
+	require.Equal(t, int64(150), w.CurrentSize())
+}
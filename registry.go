@@ -0,0 +1,45 @@
+package logr
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// registry holds the absolute paths of the files used by the writers which haven't
+// been closed.
+var registry = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// register records that the file at filename is used by a writer, and returns
+// ErrInUse if it is already.
+func register(filename string) error {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.paths[path] {
+		return ErrInUse
+	}
+	registry.paths[path] = true
+
+	return nil
+}
+
+// unregister records that the file at filename is not used by a writer anymore.
+func unregister(filename string) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	delete(registry.paths, path)
+}
@@ -0,0 +1,80 @@
+package logr
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// renameFile renames the file src to dst.
+//
+// If src and dst are not on the same file system, src is copied to dst then removed.
+func renameFile(src, dst string) error {
+	err := fsys.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	if lerr, ok := err.(*os.LinkError); !ok || lerr.Err != syscall.EXDEV {
+		return err
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		fsys.Remove(dst)
+		return err
+	}
+
+	return fsys.Remove(src)
+}
+
+// copyFile copies the content and the permissions of the file src to dst.
+func copyFile(src, dst string) error {
+	in, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := fsys.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if err := out.Chmod(fi.Mode().Perm()); err != nil {
+		out.Close()
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// syncDir commits the entries of the directory dir, such as the renamed and created
+// files, to stable storage.
+func syncDir(dir string) error {
+	d, err := fsys.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+
+	return d.Close()
+}
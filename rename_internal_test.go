@@ -0,0 +1,48 @@
+package logr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	require.Nil(t, ioutil.WriteFile(src, []byte("foobar"), 0600))
+	require.Nil(t, os.Chmod(src, 0640))
+	require.Nil(t, ioutil.WriteFile(dst, []byte("some longer content"), 0600))
+
+	require.Nil(t, copyFile(src, dst))
+
+	data, err := ioutil.ReadFile(dst)
+	require.Nil(t, err)
+	require.Equal(t, []byte("foobar"), data)
+
+	fi, err := os.Stat(dst)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+}
+
+func TestRenameFile(t *testing.T) {
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	require.Nil(t, ioutil.WriteFile(src, []byte("foobar"), 0600))
+	require.Nil(t, renameFile(src, dst))
+
+	_, err := os.Stat(src)
+	require.True(t, os.IsNotExist(err))
+
+	data, err := ioutil.ReadFile(dst)
+	require.Nil(t, err)
+	require.Equal(t, []byte("foobar"), data)
+}
@@ -0,0 +1,405 @@
+package logr
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// archive is a rotated file found on disk.
+type archive struct {
+	path    string
+	date    time.Time
+	seq     int
+	size    int64
+	modTime time.Time
+}
+
+// ArchiveInfo describes a rotated file, see ArchiveInfos.
+type ArchiveInfo struct {
+	// Path is the path of the rotated file.
+	Path string
+	// Date is the date parsed from its name, it is the modification time with
+	// SequentialNaming.
+	Date time.Time
+	// Size is its size in bytes, including the uncompressed file kept with
+	// KeepUncompressed.
+	Size int64
+	// ModTime is its modification time.
+	ModTime time.Time
+}
+
+// Archives returns the paths of the rotated files of the writer, compressed or not,
+// sorted from the newest to the oldest.
+//
+// These are the files subject to the retention: the files named after the naming
+// scheme of the writer, in the archive directory if any. The temporary files and the
+// files going with a rotated file, such as its checksum, are not included.
+func (w *RotatingWriter) Archives() ([]string, error) {
+	infos, err := w.ArchiveInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(infos))
+	for i, info := range infos {
+		paths[i] = info.Path
+	}
+
+	return paths, nil
+}
+
+// ArchiveInfos is like Archives but also returns the date, size and modification time
+// of the rotated files.
+func (w *RotatingWriter) ArchiveInfos() ([]ArchiveInfo, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	archives, err := w.listArchives()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ArchiveInfo, len(archives))
+	for i, a := range archives {
+		infos[len(archives)-1-i] = ArchiveInfo{
+			Path:    a.path,
+			Date:    a.date,
+			Size:    a.size,
+			ModTime: a.modTime,
+		}
+	}
+
+	return infos, nil
+}
+
+// MaxBackups sets the maximum number of rotated files to keep.
+//
+// After each rotation and before the first write, the oldest rotated files beyond n
+// are removed. A value of 0 or less keeps all rotated files, which is the default.
+//
+// A rotated file being compressed in background is counted once with its compressed
+// file, and if it is to be removed, it is removed once compressed.
+func (w *RotatingWriter) MaxBackups(n int) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.maxBackups = n
+
+	return w
+}
+
+// MaxAge sets the maximum age of the rotated files to keep.
+//
+// After each rotation and before the first write, the rotated files whose date is
+// older than d are removed. The date is parsed from the file name using the time
+// format. It can be combined with MaxBackups, in which case a file is removed as soon
+// as one of the conditions says so. A value of 0 or less keeps all rotated files,
+// which is the default.
+func (w *RotatingWriter) MaxAge(d time.Duration) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.maxAge = d
+
+	return w
+}
+
+// MaxTotalSize sets the maximum total size of the rotated files to keep, in bytes.
+//
+// After each rotation and before the first write, the oldest rotated files are removed
+// until the total size of the remaining ones is below s. The size of a compressed file
+// is its compressed size. It can be combined with MaxBackups and MaxAge, in which case
+// a file is removed as soon as one of the conditions says so. A value of 0 or less
+// keeps all rotated files, which is the default.
+func (w *RotatingWriter) MaxTotalSize(s int64) *RotatingWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.maxTotalSize = s
+
+	return w
+}
+
+// listArchives returns the rotated files of the writer, sorted from the oldest to the newest.
+//
+// With sequential naming, the oldest is the one with the highest sequence number.
+//
+// Files whose name can't be parsed using the time format are ignored.
+func (w *RotatingWriter) listArchives() ([]archive, error) {
+	dirs, err := w.archiveDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []archive
+	for _, dir := range dirs {
+		a, err := w.readArchives(dir)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, a...)
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		if w.sequential {
+			if archives[i].seq == archives[j].seq {
+				return archives[i].path < archives[j].path
+			}
+			return archives[i].seq > archives[j].seq
+		}
+
+		if archives[i].date.Equal(archives[j].date) {
+			if archives[i].seq == archives[j].seq {
+				return archives[i].path < archives[j].path
+			}
+			return archives[i].seq < archives[j].seq
+		}
+		return archives[i].date.Before(archives[j].date)
+	})
+
+	return archives, nil
+}
+
+// archiveDirs returns the directories containing the rotated files.
+func (w *RotatingWriter) archiveDirs() ([]string, error) {
+	if !w.partitioned() {
+		return []string{filepath.Dir(w.archivePath())}, nil
+	}
+
+	return filepath.Glob(filepath.Join(w.archiveRoot(), "[0-9]*", "[0-9]*", "[0-9]*"))
+}
+
+// readArchives returns the rotated files in the directory dir, unsorted.
+func (w *RotatingWriter) readArchives(dir string) ([]archive, error) {
+	infos, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := w.getCompressor().Extension()
+
+	sizes := make(map[string]int64, len(infos))
+	for _, fi := range infos {
+		sizes[fi.Name()] = fi.Size()
+	}
+
+	var archives []archive
+	for _, fi := range infos {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		// the uncompressed file kept along the compressed one goes with it.
+		if _, ok := sizes[fi.Name()+ext]; ok && w.keepUncompressed {
+			continue
+		}
+
+		// the compressed file of a file being compressed in background is counted once,
+		// as the file being compressed.
+		if strings.HasSuffix(fi.Name(), ext) && w.compressing(filepath.Join(dir, strings.TrimSuffix(fi.Name(), ext))) {
+			continue
+		}
+
+		date, seq, ok := w.parseDestName(fi.Name())
+		if !ok {
+			continue
+		}
+
+		if w.sequential {
+			date = fi.ModTime()
+		}
+
+		size := fi.Size()
+		if w.keepUncompressed && strings.HasSuffix(fi.Name(), ext) {
+			size += sizes[strings.TrimSuffix(fi.Name(), ext)]
+		}
+
+		archives = append(archives, archive{
+			path:    filepath.Join(dir, fi.Name()),
+			date:    date,
+			seq:     seq,
+			size:    size,
+			modTime: fi.ModTime(),
+		})
+	}
+
+	return archives, nil
+}
+
+// parseDestName extracts the date and the sequence number of a rotated file from
+// its base name.
+//
+// With sequential naming, the date is not part of the name and is left empty.
+//
+// This is the opposite of makeDestName and uniqueDestName.
+func (w *RotatingWriter) parseDestName(name string) (time.Time, int, bool) {
+	base := filepath.Base(w.filename)
+	ext := ""
+
+	if w.sequential {
+		if !strings.HasPrefix(name, base+".") {
+			return time.Time{}, 0, false
+		}
+		s := name[len(base)+1:]
+		s = strings.TrimSuffix(s, w.getCompressor().Extension())
+
+		seq, err := strconv.Atoi(s)
+		if err != nil || seq <= 0 {
+			return time.Time{}, 0, false
+		}
+
+		return time.Time{}, seq, true
+	}
+
+	if w.prefix {
+		ext = prefixExt(base)
+		base = base[:len(base)-len(ext)]
+	}
+
+	sep := w.getSeparator()
+	if !strings.HasPrefix(name, base+sep) {
+		return time.Time{}, 0, false
+	}
+	s := name[len(base)+len(sep):]
+	s = strings.TrimSuffix(s, w.getCompressor().Extension())
+
+	if date, ok := w.parseDate(s, ext); ok {
+		return date, 0, true
+	}
+
+	// the name may have a sequence number appended, before the extension with Prefix.
+	if !strings.HasSuffix(s, ext) {
+		return time.Time{}, 0, false
+	}
+	s = s[:len(s)-len(ext)]
+
+	i := strings.LastIndex(s, ".")
+	if i == -1 {
+		return time.Time{}, 0, false
+	}
+
+	seq, err := strconv.Atoi(s[i+1:])
+	if err != nil || seq <= 0 {
+		return time.Time{}, 0, false
+	}
+
+	date, ok := w.parseDate(s[:i], "")
+
+	return date, seq, ok
+}
+
+// parseDate parses the date in s, which must end with the instance and ext.
+func (w *RotatingWriter) parseDate(s, ext string) (time.Time, bool) {
+	suffix := w.instance() + ext
+	if !strings.HasSuffix(s, suffix) {
+		return time.Time{}, false
+	}
+	s = s[:len(s)-len(suffix)]
+
+	date, err := time.ParseInLocation(w.getTimeFormat(), s, w.location())
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
+
+// cleanup removes the rotated files which are not to be retained anymore.
+func (w *RotatingWriter) cleanup() error {
+	if w.maxBackups <= 0 && w.maxAge <= 0 && w.maxTotalSize <= 0 {
+		return nil
+	}
+
+	archives, err := w.listArchives()
+	if err != nil {
+		return err
+	}
+
+	var totalSize int64
+	for _, a := range archives {
+		totalSize += a.size
+	}
+
+	limit := w.currentTime().Add(-w.maxAge)
+	for i, a := range archives {
+		remove := false
+		if w.maxBackups > 0 && i < len(archives)-w.maxBackups {
+			remove = true
+		}
+		if w.maxAge > 0 && a.date.Before(limit) {
+			remove = true
+		}
+		if w.maxTotalSize > 0 && totalSize > w.maxTotalSize {
+			remove = true
+		}
+
+		if !remove {
+			continue
+		}
+		totalSize -= a.size
+
+		if w.dryRun != nil {
+			w.dryRun("remove " + a.path)
+			continue
+		}
+
+		// the file being compressed is removed once compressed.
+		if w.removeAfterCompression(a.path) {
+			continue
+		}
+
+		if err := removeArchive(a.path, w.sidecars(a.path), w.partitioned()); err != nil {
+			return err
+		}
+		atomic.AddUint64(&w.retentionDeletions, 1)
+	}
+
+	return nil
+}
+
+// removeArchive removes the rotated file at path and its sidecars, then its partition
+// directories once empty if partitioned.
+func removeArchive(path string, sidecars []string, partitioned bool) error {
+	for _, p := range append([]string{path}, sidecars...) {
+		if err := fsys.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if partitioned {
+		// remove the day, month and year directories once empty, this fails otherwise.
+		for dir, i := filepath.Dir(path), 0; i < 3; dir, i = filepath.Dir(dir), i+1 {
+			if fsys.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// sidecars returns the paths of the files going with the rotated file at path, which
+// are moved and removed with it.
+func (w *RotatingWriter) sidecars(path string) []string {
+	return w.archiver().sidecars(path)
+}
+
+// sidecars returns the paths of the files going with the rotated file at path.
+func (a archiver) sidecars(path string) []string {
+	var paths []string
+
+	if p := checksumPath(path, a.checksum); p != "" {
+		paths = append(paths, p)
+	}
+
+	if ext := a.compressor.Extension(); a.keep && strings.HasSuffix(path, ext) {
+		paths = append(paths, strings.TrimSuffix(path, ext))
+	}
+
+	return paths
+}
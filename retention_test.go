@@ -0,0 +1,402 @@
+package logr_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vrischmann/logr"
+)
+
+func tempLogFile(t testing.TB) *os.File {
+	f, err := os.Create(filepath.Join(t.TempDir(), "app.log"))
+	require.Nil(t, err)
+
+	return f
+}
+
+// dirNames returns the sorted names of the entries of dir.
+func dirNames(t testing.TB, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+
+	return names
+}
+
+func rotateAt(t testing.TB, rw *logr.RotatingWriter, now *time.Time, dates ...time.Time) {
+	for _, date := range dates {
+		*now = date
+
+		_, err := rw.Write(makeBuf(0xFF))
+		require.Nil(t, err)
+		require.Nil(t, rw.Rotate())
+	}
+}
+
+func TestMaxBackups(t *testing.T) {
+	for _, prefix := range []bool{false, true} {
+		f := tempLogFile(t)
+		dir := filepath.Dir(f.Name())
+
+		now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+		rw, err := logr.NewWriterFromFile(f)
+		require.Nil(t, err)
+		rw.Clock(func() time.Time { return now }).MaxBackups(2)
+		if prefix {
+			rw.Prefix()
+		}
+
+		// a file unrelated to the writer must not be removed.
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app.log.foobar"), nil, 0600))
+
+		rotateAt(t, rw, &now,
+			now.Add(time.Hour),
+			now.Add(2*time.Hour),
+			now.Add(3*time.Hour),
+			now.Add(4*time.Hour),
+		)
+
+		names := dirNames(t, dir)
+
+		if prefix {
+			require.Equal(t, []string{"app.2015-01-01_0200.log", "app.2015-01-01_0300.log", "app.log", "app.log.foobar"}, names)
+		} else {
+			require.Equal(t, []string{"app.log", "app.log.2015-01-01_0200", "app.log.2015-01-01_0300", "app.log.foobar"}, names)
+		}
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).MaxAge(90 * time.Minute)
+
+	rotateAt(t, rw, &now,
+		now.Add(time.Hour),
+		now.Add(2*time.Hour),
+		now.Add(3*time.Hour),
+	)
+
+	names := dirNames(t, dir)
+
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0200.gz"}, names)
+}
+
+func TestMaxBackupsWithSequence(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).MaxBackups(2).Prefix()
+
+	rotateAt(t, rw, &now, now, now, now)
+
+	names := dirNames(t, dir)
+
+	require.Equal(t, []string{"app.2015-01-01_0000.1.log.gz", "app.2015-01-01_0000.2.log.gz", "app.log"}, names)
+}
+
+func TestMaxTotalSize(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).MaxTotalSize(2500)
+
+	rotateAt(t, rw, &now,
+		now.Add(time.Hour),
+		now.Add(2*time.Hour),
+		now.Add(3*time.Hour),
+	)
+
+	names := dirNames(t, dir)
+
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0100", "app.log.2015-01-01_0200"}, names)
+}
+
+func TestCleanupBeforeFirstWrite(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	// files left by previous runs
+	for _, name := range []string{"app.log.2015-01-01_0000.gz", "app.log.2015-01-01_0100", "app.log.2015-01-01_0200", "app.log.unparseable"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.MaxBackups(1)
+
+	_, err = rw.Write(makeBuf(0xFF))
+	require.Nil(t, err)
+
+	names := dirNames(t, dir)
+
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0200", "app.log.unparseable"}, names)
+}
+
+func TestDryRun(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	for _, name := range []string{"app.log.2015-01-01_0000", "app.log.2015-01-01_0100"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("foo"), 0600))
+	}
+
+	now := time.Date(2015, time.January, 1, 2, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+
+	var actions []string
+	rw.Clock(func() time.Time { return now }).MaxBackups(1).DryRun(func(action string) {
+		actions = append(actions, action)
+	})
+
+	_, err = rw.WriteString("bar")
+	require.Nil(t, err)
+	require.Nil(t, rw.Rotate())
+	require.Equal(t, int64(0), rw.CurrentSize())
+
+	_, err = rw.WriteString("baz")
+	require.Nil(t, err)
+	require.Nil(t, rw.Close())
+
+	archive := filepath.Join(dir, "app.log.2015-01-01_0200")
+	require.Equal(t, []string{
+		"remove " + filepath.Join(dir, "app.log.2015-01-01_0000"),
+		"rename " + f.Name() + " to " + archive,
+		"compress " + archive,
+		"remove " + filepath.Join(dir, "app.log.2015-01-01_0000"),
+	}, actions)
+
+	require.Len(t, dirNames(t, dir), 3)
+	require.Equal(t, []byte("barbaz"), readFile(t, f.Name()))
+}
+
+func TestStats(t *testing.T) {
+	f := tempLogFile(t)
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).Header([]byte("header\n")).MaxBackups(1)
+
+	rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour))
+
+	_, err = rw.WriteString("foo")
+	require.Nil(t, err)
+
+	rw.Compressor(failingCompressor{})
+	require.NotNil(t, rw.Rotate())
+
+	require.Equal(t, logr.Stats{
+		BytesWritten:       3*7 + 2*1024 + 3,
+		Rotations:          3,
+		CompressionErrors:  1,
+		RetentionDeletions: 1,
+		CurrentSize:        0,
+	}, rw.Stats())
+}
+
+func TestSeparator(t *testing.T) {
+	for _, prefix := range []bool{false, true} {
+		f := tempLogFile(t)
+		dir := filepath.Dir(f.Name())
+
+		now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+		rw, err := logr.NewWriterFromFile(f)
+		require.Nil(t, err)
+		rw.Clock(func() time.Time { return now }).Separator("-").MaxBackups(1)
+		if prefix {
+			rw.Prefix()
+		}
+
+		rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour))
+
+		names := dirNames(t, dir)
+
+		expected := []string{"app.log", "app.log-2015-01-01_0100"}
+		if prefix {
+			expected = []string{"app-2015-01-01_0100.log", "app.log"}
+		}
+		require.Equal(t, expected, names)
+	}
+}
+
+func TestPrefixNames(t *testing.T) {
+	testCases := []struct {
+		filename string
+		rotated  []string
+	}{
+		{"app.log", []string{"app.2015-01-01_0100.log", "app.2015-01-01_0200.log"}},
+		{"app.log.txt", []string{"app.log.2015-01-01_0100.txt", "app.log.2015-01-01_0200.txt"}},
+		{"applog", []string{"applog.2015-01-01_0100", "applog.2015-01-01_0200"}},
+		{".applog", []string{".applog.2015-01-01_0100", ".applog.2015-01-01_0200"}},
+	}
+
+	for _, tc := range testCases {
+		dir := t.TempDir()
+
+		now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+		rw, err := logr.NewWriter(filepath.Join(dir, tc.filename))
+		require.Nil(t, err)
+		rw.Clock(func() time.Time { return now }).Prefix().MaxBackups(2)
+
+		// the oldest is removed, which requires parsing the names back.
+		rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour), now.Add(3*time.Hour))
+		require.Nil(t, rw.Close())
+
+		names := dirNames(t, dir)
+
+		expected := append([]string{tc.filename}, tc.rotated...)
+		sort.Strings(expected)
+		require.Equal(t, expected, names, tc.filename)
+	}
+}
+
+func TestIncludeHostnameAndPID(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.Nil(t, err)
+	instance := "." + hostname + "." + strconv.Itoa(os.Getpid())
+
+	for _, prefix := range []bool{false, true} {
+		f := tempLogFile(t)
+		dir := filepath.Dir(f.Name())
+
+		// rotated by another instance.
+		other := "app.log.2014-01-01_0000.otherhost.1"
+		if prefix {
+			other = "app.2014-01-01_0000.otherhost.1.log"
+		}
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, other), []byte("foo"), 0600))
+
+		now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+		rw, err := logr.NewWriterFromFile(f)
+		require.Nil(t, err)
+		rw.Clock(func() time.Time { return now }).IncludeHostname().IncludePID().MaxBackups(1)
+		if prefix {
+			rw.Prefix()
+		}
+
+		rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour))
+
+		names := dirNames(t, dir)
+
+		expected := []string{"app.log", "app.log.2015-01-01_0100" + instance, other}
+		if prefix {
+			expected = []string{"app.2015-01-01_0100" + instance + ".log", "app.log", other}
+		}
+		sort.Strings(expected)
+		require.Equal(t, expected, names)
+	}
+}
+
+func TestArchives(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	// not a rotated file.
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app.log.bak"), []byte("foo"), 0600))
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFileWithCompression(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now })
+
+	rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour))
+
+	paths, err := rw.Archives()
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "app.log.2015-01-01_0100.gz"),
+		filepath.Join(dir, "app.log.2015-01-01_0000.gz"),
+	}, paths)
+
+	infos, err := rw.ArchiveInfos()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(infos))
+	require.Equal(t, paths[0], infos[0].Path)
+	require.True(t, infos[0].Date.Equal(time.Date(2015, time.January, 1, 1, 0, 0, 0, time.Local)))
+	require.Equal(t, int64(len(readFile(t, paths[0]))), infos[0].Size)
+	require.False(t, infos[0].ModTime.IsZero())
+}
+
+func TestMaxBackupsAsyncCompression(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	release := make(chan struct{})
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).Compressor(blockingCompressor{release}).AsyncCompression(2).MaxBackups(1)
+
+	// both are being compressed when the first one is to be removed.
+	rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour))
+
+	paths, err := rw.Archives()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(paths))
+
+	close(release)
+	require.Nil(t, rw.Close())
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01_0100.blk"}, names)
+	require.Equal(t, uint64(1), rw.Stats().RetentionDeletions)
+}
+
+func TestSequenceNumbers(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).TimeFormat("2006-01-02").SequenceNumbers(3).MaxBackups(2)
+
+	rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour), now.Add(3*time.Hour))
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01.002", "app.log.2015-01-01.003"}, names)
+
+	// the sequence restarts the next day.
+	rotateAt(t, rw, &now, now.AddDate(0, 0, 1), now.AddDate(0, 0, 1))
+
+	names = dirNames(t, dir)
+	require.Equal(t, []string{"app.log", "app.log.2015-01-01.004", "app.log.2015-01-02.001"}, names)
+}
+
+func TestSequenceNumbersWithPrefix(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	now := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local)
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Clock(func() time.Time { return now }).TimeFormat("2006-01-02").SequenceNumbers(3).Prefix().MaxBackups(2)
+
+	rotateAt(t, rw, &now, now.Add(time.Hour), now.Add(2*time.Hour), now.Add(3*time.Hour))
+
+	names := dirNames(t, dir)
+	require.Equal(t, []string{"app.2015-01-01.002.log", "app.2015-01-01.003.log", "app.log"}, names)
+}
@@ -0,0 +1,61 @@
+package logr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Size units, in bytes. They are powers of 1024.
+const (
+	KB int64 = 1 << (10 * (iota + 1))
+	MB
+	GB
+	TB
+)
+
+// ParseSize parses a human readable size such as "512", "512K", "10MB" or "1.5GB"
+// and returns it in bytes.
+//
+// The units are case insensitive and are powers of 1024, see KB, MB, GB and TB. A
+// size without unit is in bytes.
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+
+	unit := int64(1)
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			unit = KB
+		case 'M':
+			unit = MB
+		case 'G':
+			unit = GB
+		case 'T':
+			unit = TB
+		}
+		if unit != 1 {
+			str = str[:len(str)-1]
+		}
+	}
+
+	// float64(math.MaxInt64) is rounded up to 2^63, which doesn't fit in an int64.
+	f, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || math.IsNaN(f) || f < 0 || f*float64(unit) >= float64(math.MaxInt64) {
+		return 0, fmt.Errorf("logr: invalid size %q", s)
+	}
+
+	return int64(f * float64(unit)), nil
+}
+
+// MustParseSize is like ParseSize but panics if the size can't be parsed.
+func MustParseSize(s string) int64 {
+	n, err := ParseSize(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
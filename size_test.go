@@ -0,0 +1,46 @@
+package logr_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vrischmann/logr"
+)
+
+func TestParseSize(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected int64
+	}{
+		{"512", 512},
+		{"512B", 512},
+		{"512K", 512 * logr.KB},
+		{"512kb", 512 * logr.KB},
+		{"10MB", 10 * logr.MB},
+		{"10 MB", 10 * logr.MB},
+		{"1.5GB", 3 * logr.GB / 2},
+		{"2T", 2 * logr.TB},
+		{"1e3", 1000},
+		{"8388607TB", 8388607 * logr.TB},
+	}
+
+	for _, tc := range testCases {
+		n, err := logr.ParseSize(tc.s)
+		require.Nil(t, err, tc.s)
+		require.Equal(t, tc.expected, n, tc.s)
+	}
+
+	for _, s := range []string{"", "MB", "foo", "-1MB", "10XB", "inf", "-Inf", "NaN", "1e30", "8388608TB"} {
+		_, err := logr.ParseSize(s)
+		require.NotNil(t, err, s)
+	}
+}
+
+func TestMustParseSize(t *testing.T) {
+	require.Equal(t, 100*logr.MB, logr.MustParseSize("100MB"))
+
+	defer func() {
+		require.NotNil(t, recover())
+	}()
+	logr.MustParseSize("foo")
+}
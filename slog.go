@@ -0,0 +1,43 @@
+package logr
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogHandler returns a slog.Handler writing the records as JSON to w.
+//
+// If the writes are buffered, the buffer is flushed after each record of level
+// slog.LevelError or above, so that they reach the file even if the process crashes
+// right after.
+func NewSlogHandler(w *RotatingWriter, opts *slog.HandlerOptions) slog.Handler {
+	return &slogHandler{
+		Handler: slog.NewJSONHandler(w, opts),
+		w:       w,
+	}
+}
+
+type slogHandler struct {
+	slog.Handler
+	w *RotatingWriter
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+
+	if r.Level < slog.LevelError {
+		return nil
+	}
+
+	return h.w.Flush()
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &slogHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	return &slogHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
@@ -0,0 +1,45 @@
+package logr_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vrischmann/logr"
+)
+
+func TestSlogHandler(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "logr")
+	require.Nil(t, err)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.Buffered(4096)
+
+	logger := slog.New(logr.NewSlogHandler(rw, nil)).With("app", "logr")
+
+	logger.Info("foobar")
+	require.Equal(t, 0, len(readFile(t, f.Name())))
+
+	logger.Error("barbaz")
+
+	r, err := os.Open(f.Name())
+	require.Nil(t, err)
+	defer r.Close()
+
+	var records []map[string]interface{}
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var record map[string]interface{}
+		require.Nil(t, dec.Decode(&record))
+		records = append(records, record)
+	}
+
+	require.Equal(t, 2, len(records))
+	require.Equal(t, "foobar", records[0]["msg"])
+	require.Equal(t, "barbaz", records[1]["msg"])
+	require.Equal(t, "logr", records[1]["app"])
+}
@@ -0,0 +1,98 @@
+package logr
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Validate checks the configuration of the writer and returns an error wrapping
+// ErrInvalidConfig if:
+//
+//   - a size, count or duration is negative, except the maximum size which is -1 when
+//     disabled, the default;
+//   - the time format has no date or time elements, or the names it gives can't be
+//     parsed back, which breaks MaxAge;
+//   - the time format contains a path separator;
+//   - several of Daily, DailyAt and Hourly are used;
+//   - the rotated files are named with sequence numbers only and partitioned by date;
+//   - KeepUncompressed or CompressMinSize is used without compression.
+//
+// The writer keeps working with an invalid configuration, Validate is meant to catch
+// mistakes early, for example right after creating the writer.
+func (w *RotatingWriter) Validate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	switch {
+	case w.maxSize < -1:
+		return fmt.Errorf("%w: negative max size", ErrInvalidConfig)
+	case w.maxLines < 0:
+		return fmt.Errorf("%w: negative max lines", ErrInvalidConfig)
+	case w.maxBackups < 0:
+		return fmt.Errorf("%w: negative max backups", ErrInvalidConfig)
+	case w.maxAge < 0:
+		return fmt.Errorf("%w: negative max age", ErrInvalidConfig)
+	case w.maxTotalSize < 0:
+		return fmt.Errorf("%w: negative max total size", ErrInvalidConfig)
+	case w.interval < 0 || w.maxOpenAge < 0 || w.minRotateInterval < 0:
+		return fmt.Errorf("%w: negative interval", ErrInvalidConfig)
+	case w.compressMinSize < 0:
+		return fmt.Errorf("%w: negative compression min size", ErrInvalidConfig)
+	}
+
+	if !w.sequential && w.nameFunc == nil {
+		if err := validateTimeFormat(w.getTimeFormat()); err != nil {
+			return err
+		}
+	}
+
+	n := 0
+	for _, ok := range []bool{w.daily, w.dailyAt != nil, w.hourly} {
+		if ok {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("%w: several of daily, daily at and hourly", ErrInvalidConfig)
+	}
+
+	if w.sequential && w.partitionByDate {
+		return fmt.Errorf("%w: sequential naming partitioned by date", ErrInvalidConfig)
+	}
+
+	if !w.compress && (w.keepUncompressed || w.compressMinSize > 0) {
+		return fmt.Errorf("%w: compression options without compression", ErrInvalidConfig)
+	}
+
+	return nil
+}
+
+// sampleTime is used to check what a time format gives.
+var sampleTime = time.Date(2001, time.February, 3, 16, 5, 6, 0, time.UTC)
+
+// validateTimeFormat returns an error wrapping ErrInvalidConfig if the time format
+// has no date or time elements, can't be parsed back or contains a path separator.
+func validateTimeFormat(format string) error {
+	if err := checkTimeFormatSeparator(format); err != nil {
+		return err
+	}
+
+	s := sampleTime.Format(format)
+	if _, err := time.Parse(format, s); err != nil || s == format {
+		return fmt.Errorf("%w: time format %q without a parsable time", ErrInvalidConfig, format)
+	}
+
+	return nil
+}
+
+// checkTimeFormatSeparator returns an error wrapping ErrInvalidConfig if the time
+// format gives a path separator, which would put the rotated files in directories
+// that the retention doesn't look into.
+func checkTimeFormatSeparator(format string) error {
+	if strings.ContainsAny(sampleTime.Format(format), `/\`) {
+		return fmt.Errorf("%w: time format %q with a path separator", ErrInvalidConfig, format)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package logr_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vrischmann/logr"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		setup func(rw *logr.RotatingWriter)
+		valid bool
+	}{
+		{"default", func(rw *logr.RotatingWriter) {}, true},
+		{"valid", func(rw *logr.RotatingWriter) {
+			rw.MaxSize(1024).Daily().TimeFormat("2006-01").Prefix().MaxBackups(3).CompressMinSize(10)
+		}, true},
+		{"compressed", func(rw *logr.RotatingWriter) {
+			rw.MaxSize(1024).Hourly().TimeFormat("2006-01-02T15").KeepUncompressed().CompressMinSize(10)
+		}, true},
+		{"negative max size", func(rw *logr.RotatingWriter) { rw.MaxSize(-5) }, false},
+		{"negative max lines", func(rw *logr.RotatingWriter) { rw.MaxLines(-1) }, false},
+		{"negative max backups", func(rw *logr.RotatingWriter) { rw.MaxBackups(-1) }, false},
+		{"negative max age", func(rw *logr.RotatingWriter) { rw.MaxAge(-time.Hour) }, false},
+		{"negative interval", func(rw *logr.RotatingWriter) { rw.Every(-time.Hour) }, false},
+		{"time format without time", func(rw *logr.RotatingWriter) { rw.TimeFormat("backup") }, false},
+		{"time format with separator", func(rw *logr.RotatingWriter) { rw.TimeFormat("2006/01/02") }, false},
+		{"sequential ignores time format", func(rw *logr.RotatingWriter) { rw.TimeFormat("backup").SequentialNaming() }, true},
+		{"daily and hourly", func(rw *logr.RotatingWriter) { rw.Daily().Hourly() }, false},
+		{"sequential partitioned", func(rw *logr.RotatingWriter) { rw.SequentialNaming().PartitionByDate() }, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rw, err := logr.NewWriterWithCompression(tempLogFile(t).Name())
+			require.Nil(t, err)
+			defer rw.Close()
+
+			tc.setup(rw)
+
+			err = rw.Validate()
+			if tc.valid {
+				require.Nil(t, err)
+			} else {
+				require.True(t, errors.Is(err, logr.ErrInvalidConfig))
+			}
+		})
+	}
+}
+
+func TestValidateCompressionOptions(t *testing.T) {
+	f := tempLogFile(t)
+
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	defer rw.Close()
+
+	rw.KeepUncompressed()
+	require.True(t, errors.Is(rw.Validate(), logr.ErrInvalidConfig))
+}
+
+func TestRotateTimeFormatWithSeparator(t *testing.T) {
+	f := tempLogFile(t)
+	dir := filepath.Dir(f.Name())
+
+	var errs []error
+	rw, err := logr.NewWriterFromFile(f)
+	require.Nil(t, err)
+	rw.TimeFormat("2006/01/02").MaxSize(1).MaxBackups(1).OnError(func(err error) {
+		errs = append(errs, err)
+	})
+
+	require.True(t, errors.Is(rw.Rotate(), logr.ErrInvalidConfig))
+
+	// the writes go on in the current file.
+	for _, s := range []string{"foo", "bar"} {
+		_, err := rw.WriteString(s)
+		require.Nil(t, err)
+	}
+	require.Nil(t, rw.Close())
+
+	require.Len(t, errs, 1)
+	require.True(t, errors.Is(errs[0], logr.ErrInvalidConfig))
+	require.Equal(t, []string{"app.log"}, dirNames(t, dir))
+	require.Equal(t, []byte("foobar"), readFile(t, f.Name()))
+}
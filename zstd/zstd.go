@@ -0,0 +1,68 @@
+// Package zstd provides a logr.Compressor compressing the rotated files with zstd.
+//
+// It is a separate module so that logr doesn't depend on a zstd implementation.
+package zstd
+
+import (
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vrischmann/logr"
+)
+
+// Extension is the extension of the compressed files.
+const Extension = ".zst"
+
+// ErrInvalidLevel is returned by New when the level is out of range.
+var ErrInvalidLevel = errors.New("logr/zstd: invalid level")
+
+// New returns a Compressor using zstd with the level, between 1 and 22 as for the zstd
+// command, otherwise New returns ErrInvalidLevel. The level is mapped to the closest
+// level supported by the encoder.
+//
+// dict is an optional dictionary, as trained by "zstd --train", which improves the
+// ratio of the logs having a repetitive structure. The same dictionary is needed to
+// decompress the files. New returns an error if it is invalid.
+func New(level int, dict []byte) (logr.Compressor, error) {
+	if level < 1 || level > 22 {
+		return nil, ErrInvalidLevel
+	}
+
+	opts := []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level))}
+	if len(dict) > 0 {
+		opts = append(opts, zstd.WithEncoderDict(dict))
+	}
+
+	// check the options, the dictionary in particular.
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	enc.Close()
+
+	return compressor{opts: opts}, nil
+}
+
+type compressor struct {
+	opts []zstd.EOption
+}
+
+func (c compressor) Extension() string {
+	return Extension
+}
+
+func (c compressor) Compress(dst io.Writer, src io.Reader) error {
+	enc, err := zstd.NewWriter(dst, c.opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(enc, src); err != nil {
+		enc.Close()
+		return err
+	}
+
+	// writes the end of the frame, the file is truncated without it.
+	return enc.Close()
+}
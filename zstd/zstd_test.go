@@ -0,0 +1,44 @@
+package zstd_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	logrzstd "github.com/vrischmann/logr/zstd"
+)
+
+func TestCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("foobar\n"), 1000)
+
+	for _, level := range []int{1, 3, 19, 22} {
+		c, err := logrzstd.New(level, nil)
+		require.Nil(t, err)
+		require.Equal(t, ".zst", c.Extension())
+
+		var buf bytes.Buffer
+		require.Nil(t, c.Compress(&buf, bytes.NewReader(data)))
+
+		dec, err := zstd.NewReader(&buf)
+		require.Nil(t, err)
+
+		decompressed, err := ioutil.ReadAll(dec)
+		dec.Close()
+		require.Nil(t, err)
+		require.Equal(t, data, decompressed)
+	}
+}
+
+func TestInvalidDictionary(t *testing.T) {
+	_, err := logrzstd.New(3, []byte("not a dictionary"))
+	require.NotNil(t, err)
+}
+
+func TestInvalidLevel(t *testing.T) {
+	for _, level := range []int{0, 23} {
+		_, err := logrzstd.New(level, nil)
+		require.Equal(t, logrzstd.ErrInvalidLevel, err)
+	}
+}